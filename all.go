@@ -0,0 +1,63 @@
+package env2config
+
+import "strings"
+
+// configNames holds the E2C_* environment variables
+type configNames struct {
+	Configs []string
+}
+
+// LoadAll returns a Config for each name in the comma separated E2C_CONFIGS environment variable.
+// Configs which fail to load are left out, and their errors are returned as Errors.
+func LoadAll(opts ...Option) ([]Config, error) {
+	o := newOptions(opts)
+	names, err := o.configNames()
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	var errs Errors
+	for _, name := range names {
+		config, err := o.newConfig(name)
+		if err != nil {
+			errs = append(errs, newConfigError(strings.ToLower(name), err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if len(errs) > 0 {
+		return configs, errs
+	}
+	return configs, nil
+}
+
+// WriteAll loads and writes each config in the comma separated E2C_CONFIGS environment variable, like the env2config command.
+// Every config is attempted, and their errors are returned together as Errors.
+func WriteAll(opts ...Option) error {
+	o := newOptions(opts)
+	names, err := o.configNames()
+	if err != nil {
+		return err
+	}
+	var errs Errors
+	for _, name := range names {
+		config, err := o.newConfig(name)
+		if err == nil {
+			err = config.Write()
+		}
+		if err != nil {
+			errs = append(errs, newConfigError(strings.ToLower(name), err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// configNames returns the names in E2C_CONFIGS
+func (o options) configNames() ([]string, error) {
+	var names configNames
+	err := processEnv("e2c", o.env, &names)
+	return names.Configs, err
+}
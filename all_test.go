@@ -0,0 +1,73 @@
+package env2config
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAll(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterFormat("gorp", &gorpMarshaler{})
+
+	t.Run("no configs", func(t *testing.T) {
+		configs, err := LoadAll(WithEnv(map[string]string{}), WithRegistry(registry))
+		assert.NoError(t, err)
+		assert.Empty(t, configs)
+	})
+
+	t.Run("some failed", func(t *testing.T) {
+		configs, err := LoadAll(
+			WithEnv(map[string]string{
+				"E2C_CONFIGS":        "first,bad name,Second",
+				"FIRST_OPTS_FILE":    "/first.gorp",
+				"FIRST_OPTS_FORMAT":  "gorp",
+				"SECOND_OPTS_FORMAT": "gorp",
+			}),
+			WithRegistry(registry),
+		)
+		require.Len(t, configs, 1)
+		assert.Equal(t, "first", configs[0].Name)
+		assert.EqualError(t, err, `Failed to generate configs:
+
+bad name: Config names must only use letters or numbers: "bad name"
+
+second: required key SECOND_OPTS_FILE missing value`)
+
+		var errs Errors
+		require.True(t, errors.As(err, &errs))
+		require.Len(t, errs, 2)
+		assert.Equal(t, "bad name", errs[0].Name)
+		assert.Equal(t, "second", errs[1].Name)
+	})
+}
+
+func TestWriteAll(t *testing.T) {
+	registry := NewRegistry()
+	marshaler := &gorpMarshaler{marshalErr: errors.New("some error")}
+	registry.RegisterFormat("gorp", marshaler)
+	registry.RegisterFormat("writeonly", writeOnlyMarshaler{})
+	fsys := memFS{}
+
+	err := WriteAll(
+		WithEnv(map[string]string{
+			"E2C_CONFIGS":        "first,second,third",
+			"FIRST_OPTS_FILE":    "/first.gorp",
+			"FIRST_OPTS_FORMAT":  "gorp",
+			"SECOND_OPTS_FORMAT": "gorp",
+			"THIRD_OPTS_FILE":    "/third.txt",
+			"THIRD_OPTS_FORMAT":  "writeonly",
+		}),
+		WithRegistry(registry),
+		WithFS(fsys),
+	)
+	assert.EqualError(t, err, `Failed to generate configs:
+
+first: some error
+
+second: required key SECOND_OPTS_FILE missing value`)
+	require.Contains(t, fsys, "/third.txt")
+	assert.Equal(t, "written", fsys["/third.txt"].String())
+}
@@ -4,19 +4,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
 
 	"github.com/johnstarich/env2config"
-	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 
 	_ "github.com/johnstarich/env2config/formats"
 )
 
-type App struct {
-	Configs []string
-}
-
 func main() {
 	err := run(os.Args[1:])
 	if err != nil {
@@ -26,21 +20,10 @@ func main() {
 }
 
 func run(args []string) error {
-	var app App
-	err := envconfig.Process("E2C", &app)
+	err := env2config.WriteAll()
 	if err != nil {
 		return err
 	}
-	var configErrs []string
-	for _, configName := range app.Configs {
-		err := writeConfig(configName)
-		if err != nil {
-			configErrs = append(configErrs, err.Error())
-		}
-	}
-	if len(configErrs) > 0 {
-		return errors.New("Failed to generate configs:\n\n" + strings.Join(configErrs, "\n\n"))
-	}
 
 	if len(args) == 0 {
 		return nil
@@ -51,12 +34,3 @@ func run(args []string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
-
-func writeConfig(name string) error {
-	config, err := env2config.New(name)
-	if err != nil {
-		return err
-	}
-	err = config.Write()
-	return errors.Wrap(err, config.Name)
-}
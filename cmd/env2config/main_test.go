@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -69,15 +70,16 @@ blank:
 		{
 			format: "ini",
 			expect: `
-FOO   = bar
-bAz0  = bit
+FOO = bar
+bAz0 = bit
 blank
+
 [bar]
-  array = ["value", "other"]
+array = value
+array = other
 
 [bar.nested]
-  key = value
-
+key = value
 `,
 		},
 		{
@@ -133,6 +135,7 @@ func TestRunTemplate(t *testing.T) {
 	setEnv(t, "MYPREFIX_bar.array.0.other_key", "value")
 	setEnv(t, "MYPREFIX_bar.array.1.key", "value")
 	setEnv(t, "MYPREFIX_bar.array.2", "value")
+	setEnv(t, "MYPREFIX_codes.500", "Internal Server Error")
 
 	require.NoError(t, ioutil.WriteFile(templateYaml, []byte(strings.TrimSpace(`
 FOO: not bar
@@ -140,6 +143,9 @@ bar:
     array:
         - key: some default
     default_key: default_value
+codes:
+    200: OK
+    404: Not Found
 no_value:
 `)), 0600))
 
@@ -148,7 +154,6 @@ no_value:
 	require.NoError(t, err)
 	assert.Equal(t, strings.TrimSpace(`
 FOO: bar
-bAz0: bit
 bar:
     array:
         - key: some default
@@ -158,7 +163,12 @@ bar:
     default_key: default_value
     nested:
         key: value
+codes:
+    200: OK
+    404: Not Found
+    500: Internal Server Error
 no_value:
+bAz0: bit
 `)+"\n", string(buf))
 }
 
@@ -221,3 +231,1328 @@ bar:
         key: value
 `)+"\n", string(buf))
 }
+
+func TestRunNullAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	tmpJSON := filepath.Join(dir, "some.json")
+	templateJSON := filepath.Join(dir, "template.json")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", tmpJSON)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "json")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateJSON)
+	setEnv(t, "MYPREFIX_database.password", "!!null")
+	setEnv(t, "MYPREFIX_database.debug", "!!delete")
+	setEnv(t, "MYPREFIX_extra", "!!delete")
+
+	require.NoError(t, ioutil.WriteFile(templateJSON, []byte(`{"database": {"debug": true, "password": "changeme"}}`), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(tmpJSON)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+{
+	"database": {
+		"password": null
+	}
+}
+`)+"\n", string(buf))
+}
+
+func TestRunTemplateOrder(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		template string
+		expect   string
+	}{
+		{
+			format: "yaml",
+			template: `
+zebra: 1
+apple:
+    zoo: 2
+    ant: 3
+`,
+			expect: `
+zebra: 1
+apple:
+    zoo: 2
+    ant: 3
+    bee: value
+mango: value
+new: value
+`,
+		},
+		{
+			format: "json",
+			template: `
+{
+	"zebra": 1,
+	"apple": {"zoo": 2, "ant": 3}
+}
+`,
+			expect: `
+{
+	"zebra": 1,
+	"apple": {
+		"zoo": 2,
+		"ant": 3,
+		"bee": "value"
+	},
+	"mango": "value",
+	"new": "value"
+}
+`,
+		},
+		{
+			format: "toml",
+			template: `
+zebra = 1
+
+[apple]
+zoo = 2
+ant = 3
+`,
+			expect: `
+zebra = 1
+mango = "value"
+new = "value"
+
+[apple]
+  zoo = 2
+  ant = 3
+  bee = "value"
+`,
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out."+tc.format)
+			templateFile := filepath.Join(dir, "template."+tc.format)
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", tc.format)
+			setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+			setEnv(t, "MYPREFIX_new", "value")
+			setEnv(t, "MYPREFIX_mango", "value")
+			setEnv(t, "MYPREFIX_apple.bee", "value")
+			require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimLeft(tc.template, "\n")), 0600))
+
+			for i := 0; i < 5; i++ {
+				assert.NoError(t, run(nil))
+				buf, err := ioutil.ReadFile(outFile)
+				require.NoError(t, err)
+				assert.Equal(t, strings.TrimLeft(tc.expect, "\n"), string(buf))
+			}
+		})
+	}
+}
+
+func TestRunYAMLTemplateFormatting(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.yaml")
+	templateFile := filepath.Join(dir, "template.yaml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "yaml")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_server.port", "9090")
+	setEnv(t, "MYPREFIX_server.name", "true")
+	setEnv(t, "MYPREFIX_prod.timeout", "60")
+	setEnv(t, "MYPREFIX_extra", "value")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+# Server settings
+server:
+    # Port to listen on
+    port: 8080 # default port
+    name: "my server"
+    tags: [a, b]
+defaults: &defaults
+    timeout: 30
+    retries: 3
+prod:
+    <<: *defaults
+    host: prod.example.com
+staging: *defaults
+# trailing comment
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+# Server settings
+server:
+    # Port to listen on
+    port: 9090 # default port
+    name: "true"
+    tags: [a, b]
+defaults: &defaults
+    timeout: 30
+    retries: 3
+prod:
+    <<: *defaults
+    host: prod.example.com
+    timeout: 60
+staging: *defaults
+extra: value
+# trailing comment
+`)+"\n", string(buf))
+}
+
+func TestRunYAMLTemplateChangedAnchor(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.yaml")
+	templateFile := filepath.Join(dir, "template.yaml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "yaml")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_defaults.timeout", "10")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+defaults: &defaults
+    timeout: 30
+prod:
+    <<: *defaults
+    host: prod.example.com
+staging: *defaults
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+defaults: &defaults
+    timeout: 10
+prod:
+    host: prod.example.com
+    timeout: 30
+staging:
+    timeout: 30
+`)+"\n", string(buf))
+}
+
+func TestRunINIDialects(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		options     map[string]string
+		expect      string
+		expectErr   string
+	}{
+		{
+			description: "default",
+			expect: `
+quoted = " padded "
+semicolon = "a ; b"
+
+[bar]
+array = value
+array = other
+
+[bar.nested]
+key = value
+
+[bar.tables.0]
+name = first
+
+[bar.tables.1]
+name = second
+`,
+		},
+		{
+			description: "custom dialect",
+			options: map[string]string{
+				"ARRAYS":            "brackets",
+				"SECTION_SEPARATOR": "/",
+				"DELIMITER":         ":",
+			},
+			expect: `
+quoted: " padded "
+semicolon: "a ; b"
+
+[bar]
+array[]: value
+array[]: other
+
+[bar/nested]
+key: value
+
+[bar/tables/0]
+name: first
+
+[bar/tables/1]
+name: second
+`,
+		},
+		{
+			description: "invalid option",
+			options: map[string]string{
+				"ARRAYS": "commas",
+			},
+			expectErr: `Invalid ini arrays option "commas", must be "repeat" or "brackets"`,
+		},
+		{
+			description: "unknown option",
+			options: map[string]string{
+				"COLOR": "blue",
+			},
+			expectErr: `Unsupported ini format option: "color"`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.ini")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", "ini")
+			for key, value := range tc.options {
+				setEnv(t, "MYPREFIX_OPTS_FORMAT_"+key, value)
+			}
+			setEnv(t, "MYPREFIX_quoted", " padded ")
+			setEnv(t, "MYPREFIX_semicolon", "a ; b")
+			setEnv(t, "MYPREFIX_bar.array.0", "value")
+			setEnv(t, "MYPREFIX_bar.array.1", "other")
+			setEnv(t, "MYPREFIX_bar.nested.key", "value")
+			setEnv(t, "MYPREFIX_bar.tables.0.name", "first")
+			setEnv(t, "MYPREFIX_bar.tables.1.name", "second")
+
+			err := run(nil)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, "Failed to generate configs:\n\nmyprefix: "+tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimLeft(tc.expect, "\n"), string(buf))
+		})
+	}
+}
+
+func TestRunINITemplate(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.ini")
+	templateFile := filepath.Join(dir, "template.ini")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "ini")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS", "database.debug,servers.1")
+	setEnv(t, "MYPREFIX_name", "new name")
+	setEnv(t, "MYPREFIX_database.port", "5433")
+	setEnv(t, "MYPREFIX_cache.size", "10")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+; Global settings
+name = old name
+verbose
+servers = a.example.com
+servers = b.example.com
+
+# Database settings
+[database]
+; Port to connect to
+port = 5432 ; default
+host: "db.example.com"
+debug = true
+
+[database.replica]
+host = replica.example.com
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+; Global settings
+name = new name
+verbose
+servers = a.example.com
+
+# Database settings
+[database]
+; Port to connect to
+port = 5433 ; default
+host = db.example.com
+
+[database.replica]
+host = replica.example.com
+
+[cache]
+size = 10
+`)+"\n", string(buf))
+}
+
+func TestRunINITemplateConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		template    string
+		expect      string
+		expectErr   string
+	}{
+		{
+			description: "section after key",
+			template:    "a = 1\n[a]\nb = 2\n",
+			expectErr:   "Failed to generate configs:\n\nmyprefix: Section \"a\" conflicts with key \"a\"",
+		},
+		{
+			description: "key after nested section",
+			template:    "[a.b]\nc = 1\n[a]\nb = 2\n",
+			expectErr:   "Failed to generate configs:\n\nmyprefix: Key \"b\" conflicts with section \"a.b\"",
+		},
+		{
+			description: "array key after key",
+			template:    "tags = a\ntags[] = b\n",
+			expect:      "tags = a\ntags = b\n",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.ini")
+			templateFile := filepath.Join(dir, "template.ini")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", "ini")
+			setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+			require.NoError(t, ioutil.WriteFile(templateFile, []byte(tc.template), 0600))
+
+			err := run(nil)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, string(buf))
+		})
+	}
+}
+
+func TestRunPropertiesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.properties")
+	templateFile := filepath.Join(dir, "template.properties")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "properties")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS", "server.debug")
+	setEnv(t, "MYPREFIX_server.port", "8081")
+	setEnv(t, "MYPREFIX_server.hosts.2", "c.example.com")
+	setEnv(t, "MYPREFIX_greeting", "hello, wörld\n= done")
+	setEnv(t, "MYPREFIX_'key with spaces'", " padded")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+# Server settings
+server.port = 8080
+server.debug: true
+server.hosts[0]=a.example.com
+! Second host
+server.hosts[1]=b.example.com
+
+app.name   My \
+    App
+# end of file
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+# Server settings
+server.port=8081
+server.hosts[0]=a.example.com
+! Second host
+server.hosts[1]=b.example.com
+
+app.name=My App
+greeting=hello, w\u00f6rld\n\= done
+key\ with\ spaces=\ padded
+server.hosts[2]=c.example.com
+# end of file
+`)+"\n", string(buf))
+}
+
+func TestRunPropertiesNestedValues(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.properties")
+	templateFile := filepath.Join(dir, "template.properties")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "properties")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_log4j.rootLogger.#value", "DEBUG, stdout")
+	setEnv(t, "MYPREFIX_log4j.appender.stdout.Target", "System.err")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+log4j.rootLogger.level=INFO
+log4j.rootLogger=INFO, stdout
+log4j.appender.stdout=org.apache.log4j.ConsoleAppender
+log4j.appender.stdout.layout=org.apache.log4j.PatternLayout
+log4j.appender.stdout.layout.ConversionPattern=%d %p %c - %m%n
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+log4j.rootLogger.level=INFO
+log4j.rootLogger=DEBUG, stdout
+log4j.appender.stdout=org.apache.log4j.ConsoleAppender
+log4j.appender.stdout.layout=org.apache.log4j.PatternLayout
+log4j.appender.stdout.layout.ConversionPattern=%d %p %c - %m%n
+log4j.appender.stdout.Target=System.err
+`)+"\n", string(buf))
+}
+
+func TestRunPropertiesArraysOption(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.properties")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "properties")
+	setEnv(t, "MYPREFIX_OPTS_FORMAT_ARRAYS", "dots")
+	setEnv(t, "MYPREFIX_list.0.name", "a")
+	setEnv(t, "MYPREFIX_list.1.name", "b")
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, "list.0.name=a\nlist.1.name=b\n", string(buf))
+}
+
+func TestRunDotenv(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		template string
+		expect   string
+	}{
+		{
+			format: "dotenv",
+			template: `
+# Database
+DB_HOST=db.example.com
+DB_PASSWORD="old \"secret\""
+
+export GREETING='hi there' # inline
+`,
+			expect: `
+# Database
+DB_HOST=db.example.com
+DB_PASSWORD="p@ss \"word\" \$HOME"
+
+GREETING="hello\nworld"
+LIST_0=a
+LIST_1="b c"
+`,
+		},
+		{
+			format: "shell",
+			template: `
+# Database
+DB_HOST=db.example.com
+export DB_PASSWORD='old '\''secret'\'''
+
+GREETING="hi there"
+`,
+			expect: `
+# Database
+export DB_HOST=db.example.com
+export DB_PASSWORD='p@ss "word" $HOME'
+
+export GREETING='hello
+world'
+export LIST_0=a
+export LIST_1='b c'
+`,
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.env")
+			templateFile := filepath.Join(dir, "template.env")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", tc.format)
+			setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+			setEnv(t, "MYPREFIX_DB_PASSWORD", `p@ss "word" $HOME`)
+			setEnv(t, "MYPREFIX_GREETING", "hello\nworld")
+			setEnv(t, "MYPREFIX_LIST.0", "a")
+			setEnv(t, "MYPREFIX_LIST.1", "b c")
+			require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(tc.template)), 0600))
+
+			assert.NoError(t, run(nil))
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tc.expect)+"\n", string(buf))
+		})
+	}
+}
+
+func TestRunDotenvJoiner(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.env")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "dotenv")
+	setEnv(t, "MYPREFIX_OPTS_FORMAT_JOINER", "__")
+	setEnv(t, "MYPREFIX_db.host", "db.example.com")
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, "db__host=db.example.com\n", string(buf))
+}
+
+func TestRunXMLTemplate(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.xml")
+	templateFile := filepath.Join(dir, "template.xml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "xml")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS", "Server.Service.Connector.1")
+	setEnv(t, "MYPREFIX_Server.@port", "8006")
+	setEnv(t, "MYPREFIX_Server.Service.Connector.0.@port", "8081")
+	setEnv(t, "MYPREFIX_Server.Service.Engine.Host.#text", "a < b & c")
+	setEnv(t, "MYPREFIX_Server.Service.Name", "Catalina")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+<?xml version="1.0" encoding="UTF-8"?>
+<!-- Tomcat server -->
+<Server port="8005" shutdown="SHUTDOWN">
+  <Service>
+    <!-- HTTP -->
+    <Connector port="8080" protocol="HTTP/1.1"/>
+    <!-- AJP -->
+    <Connector port="8009" protocol="AJP/1.3"/>
+    <Engine defaultHost="localhost">
+      <Host name="localhost">old</Host>
+      <!-- end of engine -->
+    </Engine>
+  </Service>
+</Server>
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+<?xml version="1.0" encoding="UTF-8"?>
+<!-- Tomcat server -->
+<Server port="8006" shutdown="SHUTDOWN">
+  <Service>
+    <!-- HTTP -->
+    <Connector port="8081" protocol="HTTP/1.1"/>
+    <Engine defaultHost="localhost">
+      <Host name="localhost">a &lt; b &amp; c</Host>
+      <!-- end of engine -->
+    </Engine>
+    <Name>Catalina</Name>
+  </Service>
+</Server>
+`)+"\n", string(buf))
+}
+
+func TestRunXML(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.xml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "xml")
+	setEnv(t, "MYPREFIX_configuration.appSettings.add.0.@key", "a")
+	setEnv(t, "MYPREFIX_configuration.appSettings.add.0.@value", `say "hi"`)
+	setEnv(t, "MYPREFIX_configuration.appSettings.add.1.@key", "b")
+	setEnv(t, "MYPREFIX_configuration.empty", "")
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+<?xml version="1.0" encoding="UTF-8"?>
+<configuration>
+  <appSettings>
+    <add key="a" value="say &quot;hi&quot;"/>
+    <add key="b"/>
+  </appSettings>
+  <empty/>
+</configuration>
+`)+"\n", string(buf))
+}
+
+func TestRunHCLTemplate(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.hcl")
+	templateFile := filepath.Join(dir, "template.hcl")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "hcl")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS", "listener.1")
+	setEnv(t, "MYPREFIX_datacenter", "dc2")
+	setEnv(t, "MYPREFIX_service.web.port", "8080")
+	setEnv(t, "MYPREFIX_meta.owner", "${node.name} %{if true}")
+	setEnv(t, "MYPREFIX_ports.http", "9000")
+	setEnv(t, "MYPREFIX_enable_debug", "true")
+	setEnv(t, "MYPREFIX_telemetry.statsd_address", "localhost:8125")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+# Agent settings
+datacenter = "dc1" # default
+retry_join = ["a", "b"]
+meta = {
+  team = "infra"
+}
+enable_debug = false
+data_dir = "${NOMAD_ALLOC_DIR}/data"
+
+ports {
+  http = 8500
+  dns = 8600
+}
+
+listener {
+  address = "0.0.0.0:8200"
+}
+
+listener {
+  address = "unix"
+}
+
+service "web" {
+  port = 80
+}
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+# Agent settings
+datacenter = "dc2" # default
+retry_join = ["a", "b"]
+meta = {
+  team = "infra"
+  owner = "$${node.name} %{if true}"
+}
+enable_debug = true
+data_dir = "${NOMAD_ALLOC_DIR}/data"
+
+ports {
+  http = 9000
+  dns = 8600
+}
+
+listener {
+  address = "0.0.0.0:8200"
+}
+
+service "web" {
+  port = 8080
+}
+
+telemetry {
+  statsd_address = "localhost:8125"
+}
+`)+"\n", string(buf))
+
+	setEnv(t, "MYPREFIX_ports.http", "auto")
+	assert.EqualError(t, run(nil), "Failed to generate configs:\n\nmyprefix: hcl: ports.http: invalid !!int value \"auto\"")
+}
+
+func TestRunHCLOptions(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.hcl")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "hcl")
+	setEnv(t, "MYPREFIX_OPTS_FORMAT_ATTRIBUTES", "job.*.meta")
+	setEnv(t, "MYPREFIX_OPTS_FORMAT_LABELS", "job,job.*.group")
+	setEnv(t, "MYPREFIX_job.api.datacenters.0", "dc1")
+	setEnv(t, "MYPREFIX_job.api.meta.owner", "me")
+	setEnv(t, "MYPREFIX_job.api.group.web.count", "!!int 2")
+	setEnv(t, "MYPREFIX_job.api.group.web.task.0.driver", "docker")
+	setEnv(t, "MYPREFIX_job.api.group.web.task.1.driver", "exec")
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+job "api" {
+  datacenters = ["dc1"]
+  meta = {
+    owner = "me"
+  }
+
+  group "web" {
+    count = 2
+
+    task {
+      driver = "docker"
+    }
+
+    task {
+      driver = "exec"
+    }
+  }
+}
+`)+"\n", string(buf))
+}
+
+func TestRunDirectiveTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		template    string
+		env         map[string]string
+		expect      string
+	}{
+		{
+			description: "redis",
+			template: `
+# Network
+bind 127.0.0.1
+port 6379
+
+# Snapshots
+save 900 1
+save 300 10
+requirepass "old pass"
+`,
+			env: map[string]string{
+				"MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS": "save.1",
+				"MYPREFIX_port":                      "6380",
+				"MYPREFIX_requirepass":               "new pass",
+				"MYPREFIX_maxmemory":                 "100mb",
+				"MYPREFIX_rename-command.0.0":        "CONFIG",
+				"MYPREFIX_rename-command.0.1":        "",
+			},
+			expect: `
+# Network
+bind 127.0.0.1
+port 6380
+
+# Snapshots
+save 900 1
+requirepass "new pass"
+maxmemory 100mb
+rename-command CONFIG ""
+`,
+		},
+		{
+			description: "postgres",
+			template: `
+listen_addresses = 'localhost' # what IP address(es) to listen on
+max_connections = 100	# change requires restart
+`,
+			env: map[string]string{
+				"MYPREFIX_listen_addresses": "*",
+				"MYPREFIX_log_line_prefix":  "%m [%p] ",
+			},
+			expect: `
+listen_addresses = '*' # what IP address(es) to listen on
+max_connections = 100 # change requires restart
+log_line_prefix = "%m [%p] "
+`,
+		},
+		{
+			description: "options",
+			env: map[string]string{
+				"MYPREFIX_OPTS_FORMAT_DELIMITER": "=",
+				"MYPREFIX_OPTS_FORMAT_QUOTE":     "'",
+				"MYPREFIX_OPTS_FORMAT_QUOTING":   "always",
+				"MYPREFIX_search_path":           `"$user", public`,
+				"MYPREFIX_note":                  "it's",
+			},
+			expect: `
+note = 'it''s'
+search_path = '"$user", public'
+`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.conf")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", "directive")
+			if tc.template != "" {
+				templateFile := filepath.Join(dir, "template.conf")
+				setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+				require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(tc.template)), 0600))
+			}
+			for key, value := range tc.env {
+				setEnv(t, key, value)
+			}
+
+			assert.NoError(t, run(nil))
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tc.expect)+"\n", string(buf))
+		})
+	}
+}
+
+func TestRunTOMLTypes(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		template    string
+		env         map[string]string
+		expect      string
+		expectErr   string
+	}{
+		{
+			description: "inferred",
+			env: map[string]string{
+				"MYPREFIX_port":                  "8080",
+				"MYPREFIX_ratio":                 "0.5",
+				"MYPREFIX_debug":                 "true",
+				"MYPREFIX_started":               "2020-01-02T03:04:05-07:00",
+				"MYPREFIX_name":                  "api",
+				"MYPREFIX_version":               "01",
+				"MYPREFIX_release":               "1.10",
+				"MYPREFIX_scale":                 "1.0",
+				"MYPREFIX_servers.0.host":        "a.example.com",
+				"MYPREFIX_servers.0.port":        "80",
+				"MYPREFIX_servers.1.host":        "b.example.com",
+				"MYPREFIX_servers.1.tags.0.name": "primary",
+			},
+			expect: `
+debug = true
+name = "api"
+port = 8080
+ratio = 0.5
+release = "1.10"
+scale = 1.0
+started = 2020-01-02T03:04:05-07:00
+version = "01"
+
+[[servers]]
+  host = "a.example.com"
+  port = 80
+
+[[servers]]
+  host = "b.example.com"
+
+  [[servers.tags]]
+    name = "primary"
+`,
+		},
+		{
+			description: "tagged",
+			env: map[string]string{
+				"MYPREFIX_OPTS_FORMAT_INFER_TYPES": "false",
+				"MYPREFIX_port":                    "8080",
+				"MYPREFIX_timeout":                 "!!int 30",
+				"MYPREFIX_ratio":                   "!!float 1",
+				"MYPREFIX_debug":                   "!!bool true",
+				"MYPREFIX_started":                 "!!datetime 2020-01-02T03:04:05Z",
+				"MYPREFIX_zip":                     "!!str 12345",
+			},
+			expect: `
+debug = true
+port = "8080"
+ratio = 1.0
+started = 2020-01-02T03:04:05Z
+timeout = 30
+zip = "12345"
+`,
+		},
+		{
+			description: "template strings stay strings",
+			template: `
+zip = "00000"
+port = 80
+`,
+			env: map[string]string{
+				"MYPREFIX_zip":  "12345",
+				"MYPREFIX_port": "8080",
+			},
+			expect: `
+zip = "12345"
+port = 8080
+`,
+		},
+		{
+			description: "invalid tagged value",
+			env: map[string]string{
+				"MYPREFIX_port": "!!int eighty",
+			},
+			expectErr: "Failed to generate configs:\n\nmyprefix: toml: invalid !!int value \"eighty\"",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.toml")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", "toml")
+			if tc.template != "" {
+				templateFile := filepath.Join(dir, "template.toml")
+				setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+				require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(tc.template)), 0600))
+			}
+			for key, value := range tc.env {
+				setEnv(t, key, value)
+			}
+
+			err := run(nil)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tc.expect)+"\n", string(buf))
+		})
+	}
+}
+
+func TestRunJSONCTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		template string
+		env      map[string]string
+		expect   string
+	}{
+		{
+			format: "jsonc",
+			template: `
+// Settings
+{
+	// Font size in points
+	"fontSize": 12,
+	"tabSize": 4, // spaces
+	"files": {
+		"exclude": [
+			"node_modules",
+			// build output
+			"dist",
+		],
+	},
+	/* end of settings */
+}
+`,
+			env: map[string]string{
+				"MYPREFIX_fontSize":        "14",
+				"MYPREFIX_files.exclude.2": "tmp",
+				"MYPREFIX_new":             "value",
+			},
+			expect: `
+// Settings
+{
+	// Font size in points
+	"fontSize": "14",
+	"tabSize": 4, // spaces
+	"files": {
+		"exclude": [
+			"node_modules",
+			// build output
+			"dist",
+			"tmp"
+		]
+	},
+	"new": "value"
+	/* end of settings */
+}
+`,
+		},
+		{
+			format: "json5",
+			template: `
+{
+	unquoted: 'single \'quoted\'',
+	hex: 0xFF,
+	half: .5,
+	positive: +1,
+	lines: "one \
+two",
+}
+`,
+			env: map[string]string{
+				"MYPREFIX_OPTS_FORMAT_COMMENTS": "false",
+				"MYPREFIX_OPTS_COMPACT":         "true",
+				"MYPREFIX_new":                  "value",
+			},
+			expect: `{"unquoted":"single 'quoted'","hex":255,"half":0.5,"positive":1,"lines":"one two","new":"value"}`,
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out.json")
+			templateFile := filepath.Join(dir, "template.json")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", tc.format)
+			setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+			for key, value := range tc.env {
+				setEnv(t, key, value)
+			}
+			require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(tc.template)), 0600))
+
+			assert.NoError(t, run(nil))
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tc.expect)+"\n", string(buf))
+		})
+	}
+}
+
+func TestRunPlistTemplate(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.plist")
+	templateFile := filepath.Join(dir, "template.plist")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "plist")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_Port", "8080")
+	setEnv(t, "MYPREFIX_Enabled", "false")
+	setEnv(t, "MYPREFIX_Updated", "2021-02-03T04:05:06Z")
+	setEnv(t, "MYPREFIX_Args.1", "--verbose")
+	setEnv(t, "MYPREFIX_Ratio", "!!float 0.75")
+	setEnv(t, "MYPREFIX_Secret", "!!data aGVsbG8=")
+	setEnv(t, "MYPREFIX_Version", "2")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.example.agent</string>
+	<key>Port</key>
+	<integer>80</integer>
+	<key>Enabled</key>
+	<true/>
+	<key>Updated</key>
+	<date>2020-01-02T03:04:05Z</date>
+	<key>Icon</key>
+	<data>
+	AAEC
+	</data>
+	<key>Args</key>
+	<array>
+		<string>/usr/bin/agent</string>
+	</array>
+	<key>Empty</key>
+	<dict/>
+</dict>
+</plist>
+`), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.example.agent</string>
+	<key>Port</key>
+	<integer>8080</integer>
+	<key>Enabled</key>
+	<false/>
+	<key>Updated</key>
+	<date>2021-02-03T04:05:06Z</date>
+	<key>Icon</key>
+	<data>AAEC</data>
+	<key>Args</key>
+	<array>
+		<string>/usr/bin/agent</string>
+		<string>--verbose</string>
+	</array>
+	<key>Empty</key>
+	<dict/>
+	<key>Ratio</key>
+	<real>0.75</real>
+	<key>Secret</key>
+	<data>aGVsbG8=</data>
+	<key>Version</key>
+	<string>2</string>
+</dict>
+</plist>
+`, string(buf))
+}
+
+func TestRunSchemaFile(t *testing.T) {
+	const schema = `{
+	"properties": {
+		"port": {"type": "integer"},
+		"debug": {"type": "boolean"}
+	}
+}`
+	for _, tc := range []struct {
+		format    string
+		debug     string
+		expectErr string
+	}{
+		{
+			format: "json", // writes every value as a string
+			debug:  "true",
+			expectErr: `Failed to generate configs:
+
+myprefix: Config does not match schema %s:
+- debug: expected boolean, but got string (set by MYPREFIX_debug)
+- port: expected integer, but got string (set by MYPREFIX_port)`,
+		},
+		{
+			format: "yaml", // writes plain scalars, which are only booleans if YAML reads them that way
+			debug:  "T",
+			expectErr: `Failed to generate configs:
+
+myprefix: Config does not match schema %s:
+- debug: expected boolean, but got string (set by MYPREFIX_debug)`,
+		},
+		{
+			format: "toml", // infers integers and booleans
+			debug:  "true",
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			dir := t.TempDir()
+			outFile := filepath.Join(dir, "out."+tc.format)
+			schemaFile := filepath.Join(dir, "schema.json")
+			require.NoError(t, ioutil.WriteFile(schemaFile, []byte(schema), 0600))
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", tc.format)
+			setEnv(t, "MYPREFIX_OPTS_SCHEMA_FILE", schemaFile)
+			setEnv(t, "MYPREFIX_port", "8080")
+			setEnv(t, "MYPREFIX_debug", tc.debug)
+
+			err := run(nil)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, fmt.Sprintf(tc.expectErr, schemaFile))
+				assert.NoFileExists(t, outFile)
+				return
+			}
+			assert.NoError(t, err)
+			assert.FileExists(t, outFile)
+		})
+	}
+}
+
+func TestRunYAMLMultiDocument(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.yaml")
+	templateFile := filepath.Join(dir, "template.yaml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "yaml")
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_FILE", templateFile)
+	setEnv(t, "MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS", "1")
+	setEnv(t, "MYPREFIX_0.metadata.name", "api")
+	setEnv(t, "MYPREFIX_2.spec.replicas", "3")
+	setEnv(t, "MYPREFIX_3.kind", "ConfigMap")
+	require.NoError(t, ioutil.WriteFile(templateFile, []byte(strings.TrimSpace(`
+# The service
+kind: Service
+metadata:
+  name: app
+---
+kind: Secret
+---
+kind: Deployment
+spec:
+  replicas: 1 # scale me
+`)), 0600))
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(`
+# The service
+kind: Service
+metadata:
+    name: api
+---
+kind: Deployment
+spec:
+    replicas: 3 # scale me
+---
+kind: ConfigMap
+`)+"\n", string(buf))
+}
+
+func TestRunYAMLMultiDocumentOption(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "out.yaml")
+	setEnv(t, "E2C_CONFIGS", "myprefix")
+	setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+	setEnv(t, "MYPREFIX_OPTS_FORMAT", "yaml")
+	setEnv(t, "MYPREFIX_OPTS_FORMAT_MULTI_DOCUMENT", "true")
+	setEnv(t, "MYPREFIX_0.a", "b")
+	setEnv(t, "MYPREFIX_1.c", "d")
+
+	assert.NoError(t, run(nil))
+	buf, err := ioutil.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, "a: b\n---\nc: d\n", string(buf))
+}
+
+func TestRunStyle(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		format      string
+		env         map[string]string
+		expect      string
+	}{
+		{
+			description: "json default",
+			format:      "json",
+			expect:      "{\n\t\"a\": \"b\",\n\t\"list\": [\n\t\t\"x\"\n\t]\n}\n",
+		},
+		{
+			description: "json indent",
+			format:      "json",
+			env:         map[string]string{"MYPREFIX_OPTS_INDENT": "2"},
+			expect:      "{\n  \"a\": \"b\",\n  \"list\": [\n    \"x\"\n  ]\n}\n",
+		},
+		{
+			description: "json compact without trailing newline",
+			format:      "json",
+			env: map[string]string{
+				"MYPREFIX_OPTS_COMPACT":          "true",
+				"MYPREFIX_OPTS_TRAILING_NEWLINE": "false",
+			},
+			expect: `{"a":"b","list":["x"]}`,
+		},
+		{
+			description: "yaml default",
+			format:      "yaml",
+			expect:      "a: b\nlist:\n    - x\n",
+		},
+		{
+			description: "yaml styles",
+			format:      "yaml",
+			env: map[string]string{
+				"MYPREFIX_OPTS_INDENT":         "2",
+				"MYPREFIX_OPTS_SEQUENCE_STYLE": "flow",
+				"MYPREFIX_OPTS_QUOTE_STYLE":    "double",
+			},
+			expect: "a: \"b\"\nlist: [\"x\"]\n",
+		},
+		{
+			description: "yaml indent",
+			format:      "yaml",
+			env: map[string]string{
+				"MYPREFIX_OPTS_INDENT":      "2",
+				"MYPREFIX_OPTS_QUOTE_STYLE": "single",
+			},
+			expect: "a: 'b'\nlist:\n  - 'x'\n",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			outFile := filepath.Join(t.TempDir(), "out")
+			setEnv(t, "E2C_CONFIGS", "myprefix")
+			setEnv(t, "MYPREFIX_OPTS_FILE", outFile)
+			setEnv(t, "MYPREFIX_OPTS_FORMAT", tc.format)
+			setEnv(t, "MYPREFIX_a", "b")
+			setEnv(t, "MYPREFIX_list.0", "x")
+			for key, value := range tc.env {
+				setEnv(t, key, value)
+			}
+
+			assert.NoError(t, run(nil))
+			buf, err := ioutil.ReadFile(outFile)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, string(buf))
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package env2config
 
 import (
-	"os"
+	"bytes"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
 type Config struct {
@@ -17,7 +19,11 @@ type Config struct {
 	Opts   Opts // NAME_OPTS_*
 	Values Values
 
-	registry *registry
+	registry *Registry
+	fs       FS
+	logger   Logger
+	envVars  map[string]string  // the environment variable which set each key in Values
+	schema   *jsonschema.Schema // the compiled SchemaFile
 }
 
 type Opts struct {
@@ -25,153 +31,477 @@ type Opts struct {
 	Format             string   `required:"true"`
 	TemplateFile       string   `split_words:"true"`
 	TemplateDeleteKeys []string `split_words:"true"`
+	SchemaFile         string   `split_words:"true"`
+	Strict             bool     // only allow keys in the template file
+	StrictAllowKeys    []string `split_words:"true"`
 
-	Inputs Values // NAME_OPTS_IN_*
+	Indent          string // spaces or 'tab'
+	Compact         bool
+	SequenceStyle   string `split_words:"true"`
+	QuoteStyle      string `split_words:"true"`
+	TrailingNewline *bool  `split_words:"true"`
+
+	Inputs        Values // NAME_OPTS_IN_*
+	FormatOptions Values // NAME_OPTS_FORMAT_*
 }
 
 type Values map[string]string
 
+const (
+	// nullValue is a special value to set a key to null, or the closest equivalent for the file format
+	nullValue = "!!null"
+	// deleteValue is a special value to remove a key, including keys from the template file
+	deleteValue = "!!delete"
+)
+
 var _ envconfig.Setter = Values{}
 
 func (v Values) Set(value string) error { return nil }
 
+// New returns a Config from the <name>_* environment variables, using the default registry's formats
 func New(name string) (Config, error) {
-	c, err := newConfig(name, parseEnv(os.Environ()), defaultRegistry)
-	if name != "" {
-		err = errors.Wrap(err, strings.ToLower(name))
+	return NewWithOptions(name)
+}
+
+// NewWithRegistry is like New, but uses the formats in 'registry'
+func NewWithRegistry(name string, registry *Registry) (Config, error) {
+	return NewWithOptions(name, WithRegistry(registry))
+}
+
+// NewWithOptions is like New, but configured with 'opts', like WithEnv to use values other than the process's environment variables
+func NewWithOptions(name string, opts ...Option) (Config, error) {
+	return newOptions(opts).newConfig(name)
+}
+
+// newConfig returns the config 'name' with these options. Errors for named configs are a *ConfigError.
+func (o options) newConfig(name string) (Config, error) {
+	c, err := newConfig(name, o)
+	if err != nil && name != "" {
+		return Config{}, &ConfigError{Name: strings.ToLower(name), Err: err}
 	}
 	return c, err
 }
 
-func newConfig(name string, env map[string]string, registry *registry) (Config, error) {
+// newConfig reads and validates the config 'name'. Returns ValidationErrors if there are several problems, so they can be fixed together.
+// An invalid name is returned on its own, since the config's environment variables can't be found without it.
+func newConfig(name string, o options) (Config, error) {
 	name = strings.ToLower(name)
 	if name == "" {
-		return Config{}, errors.New("Config name is required")
+		return Config{}, &InvalidNameError{}
 	}
 	trimmed := name
 	trimmed = strings.TrimFunc(trimmed, unicode.IsLetter)
 	trimmed = strings.TrimFunc(trimmed, unicode.IsNumber)
 	if trimmed != "" {
-		return Config{}, errors.Errorf("Config names must only use letters or numbers: %q", name)
+		return Config{}, &InvalidNameError{Name: name}
 	}
 	config := Config{
-		registry: registry,
+		Name:     name,
+		registry: o.registry,
+		fs:       o.fs,
+		logger:   o.logger,
 	}
-	err := envconfig.Process(name, &config)
-	if err != nil {
-		return Config{}, err
+	var errs []error
+	errs = appendErrors(errs, processEnv(name+"_opts", o.env, &config.Opts))
+	if _, err := config.Opts.style(); err != nil {
+		errs = append(errs, err)
 	}
-	config.Name = name
-	config.Opts.Inputs = filterEnvPrefix(name+"_opts_in", env)
-	config.Values = configEnvValues(name, env)
+	config.Opts.Inputs = filterEnvPrefix(name+"_opts_in", o.env)
+	config.Opts.FormatOptions = formatOptions(filterEnvPrefix(name+"_opts_format", o.env))
+	config.Values = configEnvValues(name, o.env)
+	config.envVars = configEnvVars(name, o.env)
 
 	var missingInputs []string
 	for dest, src := range config.Opts.Inputs {
-		value, isSet := env[src]
+		value, isSet := o.env[src]
 		if !isSet {
 			missingInputs = append(missingInputs, src)
 		}
 		config.Values[dest] = value
+		config.envVars[dest] = src
 	}
 	if len(missingInputs) > 0 {
 		sort.Strings(missingInputs)
-		return Config{}, errors.Errorf("Missing required environment variables: %s", strings.Join(missingInputs, ", "))
+		errs = append(errs, &MissingInputsError{Variables: missingInputs})
+	}
+	errs = append(errs, config.validate()...)
+	if err := validationError(errs); err != nil {
+		return Config{}, err
 	}
 	return config, nil
 }
 
-func (c Config) Write() error {
-	var template map[string]interface{}
+// validate returns any problems with the config's format, template file, schema file, and keys. Keeps the compiled schema for Write.
+func (c *Config) validate() []error {
+	var errs []error
+	if c.Opts.Format != "" {
+		if _, err := c.registry.marshaler(c.Opts.Format, c.marshalOptions()); err != nil {
+			errs = append(errs, err)
+		} else if c.Opts.TemplateFile != "" && !c.registry.CanRead(c.Opts.Format) {
+			errs = append(errs, &TemplateError{
+				Path: c.Opts.TemplateFile,
+				Err:  &UnsupportedFormatError{Format: c.Opts.Format, Template: true},
+			})
+		}
+	}
 	if c.Opts.TemplateFile != "" {
-		err := os.MkdirAll(filepath.Dir(c.Opts.TemplateFile), 0755)
+		f, err := c.fileSystem().Open(c.Opts.TemplateFile)
 		if err != nil {
-			return err
+			errs = append(errs, &TemplateError{Path: c.Opts.TemplateFile, Err: err})
+		} else {
+			f.Close()
 		}
-		f, err := os.Open(c.Opts.TemplateFile)
+	}
+	if c.Opts.SchemaFile != "" {
+		schema, err := c.readSchema(c.fileSystem())
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
-		defer f.Close()
-		err = c.registry.UnmarshalFormat(c.Opts.Format, f, &template)
+		c.schema = schema
+	}
+
+	keys := make([]string, 0, len(c.Values))
+	for key := range c.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := parseKeyPath(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Opts.Strict && c.Opts.TemplateFile == "" {
+		errs = append(errs, errors.Errorf("Strict mode requires a template file, set %s_OPTS_TEMPLATE_FILE", strings.ToUpper(c.Name)))
+	}
+	for _, pattern := range append(c.Opts.TemplateDeleteKeys, c.Opts.StrictAllowKeys...) {
+		if _, err := expandKeyPatterns(nil, []string{pattern}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (c Config) Write() error {
+	fsys, logger := c.fileSystem(), c.log()
+	var template map[string]interface{}
+	var formatTemplate interface{}
+	var templateKeys map[string]bool
+	if c.Opts.TemplateFile != "" {
+		logger.Printf("%s: Reading template file %s", c.Name, c.Opts.TemplateFile)
+		var err error
+		template, formatTemplate, templateKeys, err = c.readTemplate(fsys)
 		if err != nil {
-			return err
+			return &TemplateError{Path: c.Opts.TemplateFile, Err: err}
 		}
-		sortTemplateDeleteKeys(c.Opts.TemplateDeleteKeys)
-		for _, deleteKey := range c.Opts.TemplateDeleteKeys {
-			templateInt, _ := deleteKeyPath(template, parseKeyPath(deleteKey))
-			template = templateInt.(map[string]interface{})
+	}
+	if c.Opts.Strict {
+		if err := c.checkStrictKeys(templateKeys); err != nil {
+			return err
 		}
 	}
-	values := c.writableValues(template)
-	f, err := os.OpenFile(c.Opts.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	arrayTemplate, isArrayTemplate := formatTemplate.(ArrayTemplate)
+	values, err := c.writableValues(template, isArrayTemplate && arrayTemplate.IsArray())
 	if err != nil {
 		return err
 	}
+	var output bytes.Buffer
+	err = c.registry.MarshalFormat(c.Opts.Format, c.marshalOptions(), &output, values, formatTemplate)
+	if err != nil {
+		return &WriteError{Path: c.Opts.File, Err: err}
+	}
+	if c.Opts.SchemaFile != "" {
+		logger.Printf("%s: Validating against schema file %s", c.Name, c.Opts.SchemaFile)
+		if err := c.validateSchema(fsys, values, output.Bytes()); err != nil {
+			return err
+		}
+	}
+	logger.Printf("%s: Writing %s file %s", c.Name, c.Opts.Format, c.Opts.File)
+	err = c.writeFile(fsys, output.Bytes())
+	if err != nil {
+		return &WriteError{Path: c.Opts.File, Err: err}
+	}
+	return nil
+}
+
+// readTemplate reads the template file and deletes its TemplateDeleteKeys.
+// Returns the template's values, its format-specific template, and in strict mode, every key path in the file before any deletes.
+func (c Config) readTemplate(fsys FS) (map[string]interface{}, interface{}, map[string]bool, error) {
+	err := fsys.MkdirAll(filepath.Dir(c.Opts.TemplateFile), 0755)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	f, err := fsys.Open(c.Opts.TemplateFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	defer f.Close()
-	return c.registry.MarshalFormat(c.Opts.Format, f, values)
+	var template map[string]interface{}
+	formatTemplate, err := c.registry.UnmarshalFormat(c.Opts.Format, c.marshalOptions(), f, &template)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var templateKeys map[string]bool
+	if c.Opts.Strict {
+		templateKeys = keyPaths(template)
+	}
+	deleteKeys, err := expandKeyPatterns(template, c.Opts.TemplateDeleteKeys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = sortTemplateDeleteKeys(deleteKeys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, deleteKey := range deleteKeys {
+		keyPath, _ := parseKeyPath(deleteKey) // already validated by sortTemplateDeleteKeys
+		templateInt, _ := deleteKeyPath(template, keyPath)
+		template = templateInt.(map[string]interface{})
+	}
+	return template, formatTemplate, templateKeys, nil
 }
 
-func (c Config) writableValues(template map[string]interface{}) interface{} {
+func (c Config) writeFile(fsys FS, output []byte) error {
+	f, err := fsys.Create(c.Opts.File)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(output)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c Config) fileSystem() FS {
+	if c.fs == nil {
+		return osFS{}
+	}
+	return c.fs
+}
+
+func (c Config) log() Logger {
+	if c.logger == nil {
+		return nopLogger{}
+	}
+	return c.logger
+}
+
+func (c Config) marshalOptions() MarshalOptions {
+	style, _ := c.Opts.style() // already validated by newConfig
+	return MarshalOptions{
+		Format: c.Opts.FormatOptions,
+		Style:  style,
+	}
+}
+
+func (o Opts) style() (Style, error) {
+	style := Style{
+		Compact:             o.Compact,
+		SequenceStyle:       strings.ToLower(o.SequenceStyle),
+		QuoteStyle:          strings.ToLower(o.QuoteStyle),
+		OmitTrailingNewline: o.TrailingNewline != nil && !*o.TrailingNewline,
+	}
+	switch indent := strings.ToLower(o.Indent); indent {
+	case "":
+	case "tab":
+		style.Indent = "\t"
+	default:
+		spaces, err := strconv.Atoi(indent)
+		if err != nil || spaces <= 0 {
+			return Style{}, errors.Errorf("Invalid indent %q, must be a number of spaces or 'tab'", o.Indent)
+		}
+		style.Indent = strings.Repeat(" ", spaces)
+	}
+	switch style.SequenceStyle {
+	case "", SequenceBlock, SequenceFlow:
+	default:
+		return Style{}, errors.Errorf("Invalid sequence style %q, must be %q or %q", o.SequenceStyle, SequenceBlock, SequenceFlow)
+	}
+	switch style.QuoteStyle {
+	case "", QuoteSingle, QuoteDouble:
+	default:
+		return Style{}, errors.Errorf("Invalid quote style %q, must be %q or %q", o.QuoteStyle, QuoteSingle, QuoteDouble)
+	}
+	return style, nil
+}
+
+// writableValues merges the config's values into 'template'. If 'templateIsArray' is true, the template's top-level map of indexes is written as an array.
+func (c Config) writableValues(template map[string]interface{}, templateIsArray bool) (interface{}, error) {
+	// arrays holds the maps which become arrays: maps created for keys here, and template arrays converted to maps to set their indexes.
+	// Other template maps stay maps, even if all of their keys are numbers.
+	arrays := make(arrayMaps)
 	result := template
 	if result == nil {
-		result = make(map[string]interface{})
+		result = arrays.add(make(map[string]interface{}))
+	} else if templateIsArray {
+		arrays.add(result)
 	}
-	for key, value := range c.Values {
+	keys := make([]string, 0, len(c.Values))
+	for key := range c.Values {
+		keys = append(keys, key)
+	}
+	if err := sortValueKeys(keys); err != nil {
+		return nil, err
+	}
+	var deleteKeys []string
+	deleting := make(map[string]bool)
+	for _, key := range keys {
+		value := c.Values[key]
 		current := result
-		keys := parseKeyPath(key)
+		keys, err := parseKeyPath(key)
+		if err != nil {
+			return nil, err
+		}
+		if value == deleteValue {
+			deleteKey := formatKeyPath(keys)
+			if !deleting[deleteKey] { // the same key path written differently, like 'D.0' and 'D[0]', only deletes once
+				deleting[deleteKey] = true
+				deleteKeys = append(deleteKeys, deleteKey)
+			}
+			continue
+		}
 		for i := 0; i < len(keys)-1; i++ {
 			key := keys[i]
 			_, exists := current[key]
 			if !exists {
-				current[key] = make(map[string]interface{})
+				current[key] = arrays.add(make(map[string]interface{}))
 			}
 			switch next := current[key].(type) {
 			case map[string]interface{}:
 				current = next
 			case []interface{}:
-				nextMap := arrayToMap(next)
+				nextMap := arrays.add(arrayToMap(next))
 				current[key] = nextMap
 				current = nextMap
 			default:
 				// unrecognized type, just do simple override
-				nextMap := make(map[string]interface{})
+				nextMap := arrays.add(make(map[string]interface{}))
 				current[key] = nextMap
 				current = nextMap
 			}
 		}
 		lastKey := keys[len(keys)-1]
-		current[lastKey] = value
+		if value == nullValue {
+			current[lastKey] = nil
+		} else {
+			current[lastKey] = value
+		}
 	}
 
-	return mapsToArrays(result)
+	values := mapsToArrays(result, arrays)
+	err := sortTemplateDeleteKeys(deleteKeys)
+	if err != nil {
+		return nil, err
+	}
+	for _, deleteKey := range deleteKeys {
+		keyPath, _ := parseKeyPath(deleteKey) // already validated by sortTemplateDeleteKeys
+		values, _ = deleteKeyPath(values, keyPath)
+	}
+	return values, nil
 }
 
-func mapsToArrays(m map[string]interface{}) interface{} {
+// checkStrictKeys returns an *UnknownKeysError if any values set keys which aren't in 'templateKeys', unless they match StrictAllowKeys
+func (c Config) checkStrictKeys(templateKeys map[string]bool) error {
+	// build a tree of the unknown keys, so allow patterns match them the same way as template delete keys
+	unknown := make(map[string]interface{})
+	for key, value := range c.Values {
+		keyPath, err := parseKeyPath(key)
+		if err != nil {
+			return err
+		}
+		if value == deleteValue {
+			continue // deleting a missing key doesn't add anything
+		}
+		if templateKeys[formatKeyPath(keyPath)] {
+			continue
+		}
+		current := unknown
+		for _, key := range keyPath[:len(keyPath)-1] {
+			next, isMap := current[key].(map[string]interface{})
+			if !isMap {
+				next = make(map[string]interface{})
+				current[key] = next
+			}
+			current = next
+		}
+		lastKey := keyPath[len(keyPath)-1]
+		if _, exists := current[lastKey]; !exists {
+			current[lastKey] = nil
+		}
+	}
+	allowedKeys, err := expandKeyPatterns(unknown, c.Opts.StrictAllowKeys)
+	if err != nil {
+		return err
+	}
+	allowed := make(map[string]bool, len(allowedKeys))
+	for _, key := range allowedKeys {
+		allowed[key] = true
+	}
+	var keys []string
+	matchKeyPattern(unknown, []keySegment{{key: anyKeyPath}}, nil, func(keyPath []string) {
+		if value, _ := lookupKeyPath(unknown, keyPath); value != nil {
+			return // only report the keys set by values, not their parents
+		}
+		for i := range keyPath {
+			if allowed[formatKeyPath(keyPath[:i+1])] {
+				return // key or a parent of key is allowed
+			}
+		}
+		keys = append(keys, formatKeyPath(keyPath))
+	})
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return &UnknownKeysError{Path: c.Opts.TemplateFile, Keys: keys}
+}
+
+// mapsToArrays converts the maps in 'arrays' into arrays, if all of their keys are indexes
+func mapsToArrays(m map[string]interface{}, arrays arrayMaps) interface{} {
 	isArray := true
 	for key, value := range m {
 		if mapValue, isMap := value.(map[string]interface{}); isMap {
-			m[key] = mapsToArrays(mapValue)
+			m[key] = mapsToArrays(mapValue, arrays)
 		}
 		if strings.TrimFunc(key, unicode.IsNumber) != "" {
 			isArray = false
 		}
 	}
-	if !isArray {
+	if !isArray || len(m) == 0 || !arrays.has(m) {
+		// template maps stay maps, even with numeric keys like HTTP status codes
 		return m
 	}
-	// Must be an array, or empty set.
-	// Empty set shouldn't be possible based on logic of writableValues().
-	values := make([]interface{}, len(m))
-	for key, value := range m {
-		index, err := strconv.ParseInt(key, 10, 64)
+	// indexes can have gaps, like after a template's array element is deleted, so keep their order without the gaps
+	indexes := make([]int, 0, len(m))
+	indexKeys := make(map[int]string, len(m))
+	for key := range m {
+		index, err := strconv.Atoi(key)
 		if err != nil {
 			panic(err) // string is all digits so must parse as int
 		}
-		values[index] = value
+		indexes = append(indexes, index)
+		indexKeys[index] = key
+	}
+	sort.Ints(indexes)
+	values := make([]interface{}, len(indexes))
+	for ix, index := range indexes {
+		values[ix] = m[indexKeys[index]]
 	}
 	return values
 }
 
+// arrayMaps is a set of maps, by identity
+type arrayMaps map[uintptr]bool
+
+func (a arrayMaps) add(m map[string]interface{}) map[string]interface{} {
+	a[reflect.ValueOf(m).Pointer()] = true
+	return m
+}
+
+func (a arrayMaps) has(m map[string]interface{}) bool {
+	return a[reflect.ValueOf(m).Pointer()]
+}
+
 func arrayToMap(a []interface{}) map[string]interface{} {
 	m := make(map[string]interface{}, len(a))
 	for index, value := range a {
@@ -1,6 +1,8 @@
 package env2config
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -42,7 +44,7 @@ func (g *gorpMarshaler) Unmarshal(r io.Reader, value interface{}) error {
 }
 
 func TestNew(t *testing.T) {
-	RegisterFormat("gorp", &gorpMarshaler{})
+	ReplaceFormat("gorp", &gorpMarshaler{})
 	setEnv(t, "MYPREFIX_OPTS_FILE", "/some/path.gorp")
 	setEnv(t, "MYPREFIX_OPTS_FORMAT", "gorp")
 
@@ -68,6 +70,11 @@ func TestNew(t *testing.T) {
 				"port": "8080",
 			},
 			registry: defaultRegistry,
+			envVars: map[string]string{
+				"FOO":  "MYPREFIX_FOO",
+				"bAz0": "MYPREFIX_bAz0",
+				"port": "BIND_PORT",
+			},
 		}, config)
 		assert.NoError(t, err)
 	})
@@ -87,6 +94,36 @@ func TestNew(t *testing.T) {
 		_, err := New("not a valid name")
 		assert.EqualError(t, err, `not a valid name: Config names must only use letters or numbers: "not a valid name"`)
 	})
+
+	t.Run("style", func(t *testing.T) {
+		setEnv(t, "MYPREFIX_OPTS_INDENT", "2")
+		setEnv(t, "MYPREFIX_OPTS_SEQUENCE_STYLE", "Flow")
+		setEnv(t, "MYPREFIX_OPTS_TRAILING_NEWLINE", "false")
+		config, err := New("MYPREFIX")
+		require.NoError(t, err)
+		assert.Equal(t, Style{
+			Indent:              "  ",
+			SequenceStyle:       SequenceFlow,
+			OmitTrailingNewline: true,
+		}, config.marshalOptions().Style)
+	})
+
+	for _, tc := range []struct {
+		key, value string
+		expectErr  string
+	}{
+		{"MYPREFIX_OPTS_INDENT", "none", `myprefix: Invalid indent "none", must be a number of spaces or 'tab'`},
+		{"MYPREFIX_OPTS_INDENT", "0", `myprefix: Invalid indent "0", must be a number of spaces or 'tab'`},
+		{"MYPREFIX_OPTS_SEQUENCE_STYLE", "inline", `myprefix: Invalid sequence style "inline", must be "block" or "flow"`},
+		{"MYPREFIX_OPTS_QUOTE_STYLE", "back", `myprefix: Invalid quote style "back", must be "single" or "double"`},
+		{"MYPREFIX_OPTS_STRICT", "true", `myprefix: Strict mode requires a template file, set MYPREFIX_OPTS_TEMPLATE_FILE`},
+	} {
+		t.Run("invalid "+tc.key, func(t *testing.T) {
+			setEnv(t, tc.key, tc.value)
+			_, err := New("MYPREFIX")
+			assert.EqualError(t, err, tc.expectErr)
+		})
+	}
 }
 
 func TestWrite(t *testing.T) {
@@ -149,6 +186,34 @@ func TestWrite(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "quoted key paths",
+			config: Config{
+				Opts: Opts{Format: "gorp", File: tempFile},
+				Values: map[string]string{
+					`A["b.c"].D`: "E",
+					`A.'f g'[0]`: "H",
+				},
+			},
+			expectMarshal: map[string]interface{}{
+				"A": map[string]interface{}{
+					"b.c": map[string]interface{}{
+						"D": "E",
+					},
+					"f g": []interface{}{"H"},
+				},
+			},
+		},
+		{
+			description: "invalid key path",
+			config: Config{
+				Opts: Opts{Format: "gorp", File: tempFile},
+				Values: map[string]string{
+					"A..B": "C",
+				},
+			},
+			expectErr: `Invalid key "A..B": column 3: empty key segment`,
+		},
 		{
 			description: "marshal err",
 			config: Config{
@@ -221,6 +286,194 @@ func TestWrite(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "template delete key patterns",
+			config: Config{
+				Opts: Opts{
+					Format:             "gorp",
+					File:               tempFile,
+					TemplateFile:       templateFile,
+					TemplateDeleteKeys: []string{"A.*", "!A.3", "!A.10", "**.debug"},
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"A": []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+				"B": []interface{}{
+					map[string]interface{}{"debug": true, "C": "D"},
+				},
+				"debug": true,
+			},
+			expectMarshal: map[string]interface{}{
+				"A": []interface{}{3, 10},
+				"B": []interface{}{
+					map[string]interface{}{"C": "D"},
+				},
+			},
+		},
+		{
+			description: "null and delete values",
+			config: Config{
+				Opts: Opts{
+					Format:       "gorp",
+					File:         tempFile,
+					TemplateFile: templateFile,
+				},
+				Values: map[string]string{
+					"A":     "!!null",
+					"B.C":   "!!delete",
+					"D.0":   "!!delete",
+					"D.2":   "!!delete",
+					"E":     "!!delete",
+					"F.G.H": "!!delete",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"A": "default",
+				"B": map[string]interface{}{
+					"C": "D",
+					"E": "F",
+				},
+				"D": []interface{}{"x", "y", "z"},
+			},
+			expectMarshal: map[string]interface{}{
+				"A": nil,
+				"B": map[string]interface{}{
+					"E": "F",
+				},
+				"D": []interface{}{"y"},
+			},
+		},
+		{
+			description: "strict keys",
+			config: Config{
+				Opts: Opts{
+					Format:          "gorp",
+					File:            tempFile,
+					TemplateFile:    templateFile,
+					Strict:          true,
+					StrictAllowKeys: []string{"plugins", "servers.*.tags", "!plugins.auth"},
+				},
+				Values: map[string]string{
+					"A":                "overridden",
+					"B.C":              "!!delete",
+					"D.1":              "y",
+					"plugins.metrics":  "true",
+					"servers.0.tags.0": "web",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"A":       "default",
+				"D":       []interface{}{"x", "z"},
+				"servers": []interface{}{map[string]interface{}{"host": "example.com"}},
+			},
+			expectMarshal: map[string]interface{}{
+				"A":       "overridden",
+				"D":       []interface{}{"x", "y"},
+				"plugins": map[string]interface{}{"metrics": "true"},
+				"servers": []interface{}{
+					map[string]interface{}{
+						"host": "example.com",
+						"tags": []interface{}{"web"},
+					},
+				},
+			},
+		},
+		{
+			description: "strict unknown keys",
+			config: Config{
+				Opts: Opts{
+					Format:          "gorp",
+					File:            tempFile,
+					TemplateFile:    templateFile,
+					Strict:          true,
+					StrictAllowKeys: []string{"plugins", "!plugins.auth"},
+				},
+				Values: map[string]string{
+					"A":                "overridden",
+					"D.2":              "z",
+					"E.F":              "G",
+					"plugins.auth.key": "secret",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"A": "default",
+				"D": []interface{}{"x", "y"},
+			},
+			expectErr: "Strict mode only allows keys in the template file " + templateFile + " or the strict allow keys, found: D.2, E.F, plugins.auth.key",
+		},
+		{
+			description: "strict keys deleted from the template",
+			config: Config{
+				Opts: Opts{
+					Format:             "gorp",
+					File:               tempFile,
+					TemplateFile:       templateFile,
+					TemplateDeleteKeys: []string{"A"},
+					Strict:             true,
+				},
+				Values: map[string]string{
+					"A": "5",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"A": map[string]interface{}{"B": "C"},
+			},
+			expectMarshal: map[string]interface{}{
+				"A": "5",
+			},
+		},
+		{
+			description: "numeric template map keys",
+			config: Config{
+				Opts: Opts{
+					Format:       "gorp",
+					File:         tempFile,
+					TemplateFile: templateFile,
+				},
+				Values: map[string]string{
+					"codes.500": "Error",
+					"list.1":    "b",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"codes": map[string]interface{}{"200": "OK", "404": "Not Found"},
+				"list":  []interface{}{"a"},
+			},
+			expectMarshal: map[string]interface{}{
+				"codes": map[string]interface{}{"200": "OK", "404": "Not Found", "500": "Error"},
+				"list":  []interface{}{"a", "b"},
+			},
+		},
+		{
+			description: "delete the same key written differently",
+			config: Config{
+				Opts: Opts{Format: "gorp", File: tempFile, TemplateFile: templateFile},
+				Values: map[string]string{
+					"D.0":  "!!delete",
+					"D[0]": "!!delete",
+				},
+			},
+			unmarshalResult: map[string]interface{}{
+				"D": []interface{}{"x", "y", "z"},
+			},
+			expectMarshal: map[string]interface{}{
+				"D": []interface{}{"y", "z"},
+			},
+		},
+		{
+			description: "sparse array indexes",
+			config: Config{
+				Opts: Opts{Format: "gorp", File: tempFile},
+				Values: map[string]string{
+					"A.10": "c",
+					"A.2":  "b",
+					"A.1":  "a",
+				},
+			},
+			expectMarshal: map[string]interface{}{
+				"A": []interface{}{"a", "b", "c"},
+			},
+		},
 		{
 			description: "nested key array paths",
 			config: Config{
@@ -245,7 +498,7 @@ func TestWrite(t *testing.T) {
 				marshalErr:      tc.marshalErr,
 				unmarshalResult: tc.unmarshalResult,
 			}
-			tc.config.registry = newRegistry()
+			tc.config.registry = NewRegistry()
 			tc.config.registry.RegisterFormat("gorp", marshaler)
 
 			err := tc.config.Write()
@@ -258,3 +511,137 @@ func TestWrite(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteOverlappingKeys(t *testing.T) {
+	// nested keys replace their parents' values, no matter the map iteration order
+	for i := 0; i < 20; i++ {
+		registry := NewRegistry()
+		marshaler := &gorpMarshaler{}
+		registry.RegisterFormat("gorp", marshaler)
+		config := Config{
+			Opts: Opts{Format: "gorp", File: "/out.gorp"},
+			Values: map[string]string{
+				"a":   "1",
+				"a.b": "2",
+				"x.y": "3",
+				"x":   "4",
+			},
+			registry: registry,
+			fs:       memFS{},
+		}
+		require.NoError(t, config.Write())
+		assert.Equal(t, map[string]interface{}{
+			"a": map[string]interface{}{"b": "2"},
+			"x": map[string]interface{}{"y": "3"},
+		}, marshaler.marshaledValue)
+	}
+}
+
+type memFS map[string]*bytes.Buffer
+
+func (m memFS) Open(name string) (io.ReadCloser, error) {
+	buf, exists := m[name]
+	if !exists {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (m memFS) Create(name string) (io.WriteCloser, error) {
+	m[name] = &bytes.Buffer{}
+	return nopWriteCloser{m[name]}, nil
+}
+
+func (m memFS) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+type logRecorder struct {
+	lines []string
+}
+
+func (l *logRecorder) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("env, registry, fs, and logger", func(t *testing.T) {
+		registry := NewRegistry()
+		marshaler := &gorpMarshaler{
+			unmarshalResult: map[string]interface{}{"C": "D"},
+		}
+		registry.RegisterFormat("gorp", marshaler)
+		fsys := memFS{"/template.gorp": &bytes.Buffer{}}
+		logger := &logRecorder{}
+
+		config, err := NewWithOptions("MYPREFIX",
+			WithEnv(map[string]string{
+				"MYPREFIX_OPTS_FILE":          "/out.gorp",
+				"MYPREFIX_OPTS_FORMAT":        "gorp",
+				"MYPREFIX_OPTS_TEMPLATE_FILE": "/template.gorp",
+				"MYPREFIX_OPTS_COMPACT":       "true",
+				"MYPREFIX_OPTS_IN_port":       "BIND_PORT",
+				"BIND_PORT":                   "8080",
+				"MYPREFIX_A":                  "B",
+			}),
+			WithRegistry(registry),
+			WithFS(fsys),
+			WithLogger(logger),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, Opts{
+			File:         "/out.gorp",
+			Format:       "gorp",
+			TemplateFile: "/template.gorp",
+			Compact:      true,
+			Inputs:       Values{"port": "BIND_PORT"},
+		}, config.Opts)
+		assert.Equal(t, Values{"A": "B", "port": "8080"}, config.Values)
+
+		require.NoError(t, config.Write())
+		assert.Equal(t, map[string]interface{}{
+			"A":    "B",
+			"C":    "D",
+			"port": "8080",
+		}, marshaler.marshaledValue)
+		assert.Contains(t, fsys, "/out.gorp")
+		assert.Equal(t, []string{
+			"myprefix: Reading template file /template.gorp",
+			"myprefix: Writing gorp file /out.gorp",
+		}, logger.lines)
+	})
+
+	for _, tc := range []struct {
+		description string
+		env         map[string]string
+		expectErr   string
+	}{
+		{
+			description: "missing required opt",
+			env:         map[string]string{"MYPREFIX_OPTS_FORMAT": "gorp"},
+			expectErr:   "myprefix: required key MYPREFIX_OPTS_FILE missing value",
+		},
+		{
+			description: "invalid opt",
+			env: map[string]string{
+				"MYPREFIX_OPTS_FILE":    "/out.gorp",
+				"MYPREFIX_OPTS_FORMAT":  "gorp",
+				"MYPREFIX_OPTS_COMPACT": "sometimes",
+			},
+			expectErr: `myprefix: envconfig.Process: assigning MYPREFIX_OPTS_COMPACT to Compact: converting 'sometimes' to type bool. details: strconv.ParseBool: parsing "sometimes": invalid syntax`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.RegisterFormat("gorp", &gorpMarshaler{})
+			_, err := NewWithOptions("MYPREFIX", WithEnv(tc.env), WithRegistry(registry))
+			assert.EqualError(t, err, tc.expectErr)
+		})
+	}
+}
@@ -1,6 +1,14 @@
 package env2config
 
-import "strings"
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kelseyhightower/envconfig"
+)
 
 func parseEnv(envPairs []string) map[string]string {
 	env := make(map[string]string)
@@ -23,6 +31,19 @@ func configEnvValues(name string, env map[string]string) map[string]string {
 	return env
 }
 
+// configEnvVars returns the environment variable behind each of configEnvValues' keys, with the casing it was set with
+func configEnvVars(name string, env map[string]string) map[string]string {
+	prefix := name + "_"
+	envVars := make(map[string]string)
+	for envVar := range env {
+		if len(envVar) > len(prefix) && strings.EqualFold(prefix, envVar[:len(prefix)]) {
+			envVars[envVar[len(prefix):]] = envVar
+		}
+	}
+	removeEnvOpts(envVars)
+	return envVars
+}
+
 func filterEnvPrefix(prefix string, env map[string]string) map[string]string {
 	prefix += "_"
 	prefixLen := len(prefix)
@@ -45,3 +66,96 @@ func removeEnvOpts(m map[string]string) {
 		}
 	}
 }
+
+// formatOptions lowercases format option names
+func formatOptions(env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	options := make(map[string]string, len(env))
+	for key, value := range env {
+		options[strings.ToLower(key)] = value
+	}
+	return options
+}
+
+// processEnv sets the fields of the struct pointer 'spec' from 'env', like envconfig.Process does with the process's environment.
+// Supports the 'required' and 'split_words' tags, and string, bool, pointer, comma separated []string, and envconfig.Setter fields.
+func processEnv(prefix string, env map[string]string, spec interface{}) error {
+	specValue := reflect.ValueOf(spec).Elem()
+	specType := specValue.Type()
+	var errs []error
+	for i := 0; i < specType.NumField(); i++ {
+		fieldType := specType.Field(i)
+		field := specValue.Field(i)
+		key := fieldType.Name
+		if fieldType.Tag.Get("split_words") == "true" {
+			key = splitWords(key)
+		}
+		key = strings.ToUpper(prefix + "_" + key)
+
+		value, isSet := env[key]
+		if !isSet {
+			if fieldType.Tag.Get("required") == "true" {
+				errs = append(errs, fmt.Errorf("required key %s missing value", key))
+			}
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, &envconfig.ParseError{
+				KeyName:   key,
+				FieldName: fieldType.Name,
+				TypeName:  field.Type().String(),
+				Value:     value,
+				Err:       err,
+			})
+		}
+	}
+	return validationError(errs)
+}
+
+// splitWords separates camel case words with underscores, like TemplateFile to Template_File
+func splitWords(s string) string {
+	var words strings.Builder
+	for ix, r := range s {
+		if ix > 0 && unicode.IsUpper(r) {
+			words.WriteRune('_')
+		}
+		words.WriteRune(r)
+	}
+	return words.String()
+}
+
+func setField(field reflect.Value, value string) error {
+	if setter, ok := field.Addr().Interface().(envconfig.Setter); ok {
+		return setter.Set(value)
+	}
+	switch field.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var values []string
+		if strings.TrimSpace(value) != "" {
+			values = strings.Split(value, ",")
+		}
+		field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package env2config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigError is an error from loading or writing the config 'Name'
+type ConfigError struct {
+	Name string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Name == "" {
+		return e.Err.Error()
+	}
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, for use with errors.Cause from github.com/pkg/errors
+func (e *ConfigError) Cause() error {
+	return e.Err
+}
+
+// newConfigError returns 'err' as a *ConfigError for 'name', unless it already is one
+func newConfigError(name string, err error) *ConfigError {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr
+	}
+	return &ConfigError{Name: name, Err: err}
+}
+
+// Errors holds the errors from several configs, like from LoadAll and WriteAll, in config order
+type Errors []*ConfigError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for ix, err := range e {
+		messages[ix] = err.Error()
+	}
+	return "Failed to generate configs:\n\n" + strings.Join(messages, "\n\n")
+}
+
+// ValidationErrors holds every problem found with a config, so they can be fixed together
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for ix, err := range e {
+		messages[ix] = "- " + err.Error()
+	}
+	return fmt.Sprintf("%d problems:\n", len(e)) + strings.Join(messages, "\n")
+}
+
+// As finds the first error in 'e' which matches 'target', for use with errors.As
+func (e ValidationErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is returns true if any error in 'e' matches 'target', for use with errors.Is
+func (e ValidationErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendErrors appends 'err' to 'errs', flattening ValidationErrors
+func appendErrors(errs []error, err error) []error {
+	if validationErrs, ok := err.(ValidationErrors); ok {
+		return append(errs, validationErrs...)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// validationError returns nil for no errors, the error itself for one error, or ValidationErrors for several
+func validationError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return ValidationErrors(errs)
+	}
+}
+
+// InvalidNameError is returned for an empty config name, or one with characters other than letters and numbers
+type InvalidNameError struct {
+	Name string
+}
+
+func (e *InvalidNameError) Error() string {
+	if e.Name == "" {
+		return "Config name is required"
+	}
+	return fmt.Sprintf("Config names must only use letters or numbers: %q", e.Name)
+}
+
+// MissingInputsError is returned when <name>_OPTS_IN_* variables refer to environment variables which are not set
+type MissingInputsError struct {
+	// Variables are the sorted names of the missing environment variables
+	Variables []string
+}
+
+func (e *MissingInputsError) Error() string {
+	return "Missing required environment variables: " + strings.Join(e.Variables, ", ")
+}
+
+// UnsupportedFormatError is returned when a format is not registered, or it can't read template files
+type UnsupportedFormatError struct {
+	Format string
+	// Template is true if the format was used to read a template file
+	Template bool
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	if e.Template {
+		return fmt.Sprintf("Unsupported template file format: %q", e.Format)
+	}
+	return fmt.Sprintf("Unsupported file format: %q", e.Format)
+}
+
+// TemplateError is returned when a template file can't be read, parsed, or have its keys deleted
+type TemplateError struct {
+	Path string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, for use with errors.Cause from github.com/pkg/errors
+func (e *TemplateError) Cause() error {
+	return e.Err
+}
+
+// WriteError is returned when a config file can't be created or written
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error, for use with errors.Cause from github.com/pkg/errors
+func (e *WriteError) Cause() error {
+	return e.Err
+}
+
+// UnknownKeysError is returned by <name>_OPTS_STRICT when values set keys which are not in the template file or <name>_OPTS_STRICT_ALLOW_KEYS
+type UnknownKeysError struct {
+	// Path is the template file, if any
+	Path string
+	// Keys are the sorted key paths missing from the template
+	Keys []string
+}
+
+func (e *UnknownKeysError) Error() string {
+	template := "the template file"
+	if e.Path != "" {
+		template += " " + e.Path
+	}
+	return fmt.Sprintf("Strict mode only allows keys in %s or the strict allow keys, found: %s", template, strings.Join(e.Keys, ", "))
+}
@@ -0,0 +1,153 @@
+package env2config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedErrors(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterFormat("gorp", &gorpMarshaler{})
+	registry.RegisterFormat("writeonly", writeOnlyMarshaler{})
+	newConfig := func(env map[string]string) (Config, error) {
+		return NewWithOptions("MYPREFIX", WithEnv(env), WithRegistry(registry), WithFS(memFS{}))
+	}
+
+	t.Run("invalid name", func(t *testing.T) {
+		_, err := NewWithOptions("not valid", WithEnv(map[string]string{}))
+		var nameErr *InvalidNameError
+		require.True(t, errors.As(err, &nameErr))
+		assert.Equal(t, "not valid", nameErr.Name)
+
+		var configErr *ConfigError
+		require.True(t, errors.As(err, &configErr))
+		assert.Equal(t, "not valid", configErr.Name)
+	})
+
+	t.Run("missing inputs", func(t *testing.T) {
+		_, err := newConfig(map[string]string{
+			"MYPREFIX_OPTS_FILE":    "/out.gorp",
+			"MYPREFIX_OPTS_FORMAT":  "gorp",
+			"MYPREFIX_OPTS_IN_b":    "B_VAR",
+			"MYPREFIX_OPTS_IN_a":    "A_VAR",
+			"MYPREFIX_OPTS_IN_seta": "SET_VAR",
+			"SET_VAR":               "value",
+		})
+		assert.EqualError(t, err, "myprefix: Missing required environment variables: A_VAR, B_VAR")
+		var inputsErr *MissingInputsError
+		require.True(t, errors.As(err, &inputsErr))
+		assert.Equal(t, []string{"A_VAR", "B_VAR"}, inputsErr.Variables)
+	})
+
+	t.Run("template error", func(t *testing.T) {
+		_, err := newConfig(map[string]string{
+			"MYPREFIX_OPTS_FILE":          "/out.gorp",
+			"MYPREFIX_OPTS_FORMAT":        "gorp",
+			"MYPREFIX_OPTS_TEMPLATE_FILE": "/missing.gorp",
+		})
+		assert.EqualError(t, err, "myprefix: "+os.ErrNotExist.Error())
+		var templateErr *TemplateError
+		require.True(t, errors.As(err, &templateErr))
+		assert.Equal(t, "/missing.gorp", templateErr.Path)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("unsupported template format", func(t *testing.T) {
+		_, err := NewWithOptions("MYPREFIX",
+			WithEnv(map[string]string{
+				"MYPREFIX_OPTS_FILE":          "/out.txt",
+				"MYPREFIX_OPTS_FORMAT":        "writeonly",
+				"MYPREFIX_OPTS_TEMPLATE_FILE": "/template.txt",
+			}),
+			WithRegistry(registry),
+			WithFS(memFS{"/template.txt": &bytes.Buffer{}}),
+		)
+		assert.EqualError(t, err, `myprefix: Unsupported template file format: "writeonly"`)
+		var formatErr *UnsupportedFormatError
+		require.True(t, errors.As(err, &formatErr))
+		assert.Equal(t, &UnsupportedFormatError{Format: "writeonly", Template: true}, formatErr)
+		var templateErr *TemplateError
+		assert.True(t, errors.As(err, &templateErr))
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.RegisterFormat("gorp", &gorpMarshaler{unmarshalResult: map[string]interface{}{"c": "3"}})
+		config, err := NewWithOptions("MYPREFIX",
+			WithEnv(map[string]string{
+				"MYPREFIX_OPTS_FILE":              "/out.gorp",
+				"MYPREFIX_OPTS_FORMAT":            "gorp",
+				"MYPREFIX_OPTS_TEMPLATE_FILE":     "/template.gorp",
+				"MYPREFIX_OPTS_STRICT":            "true",
+				"MYPREFIX_OPTS_STRICT_ALLOW_KEYS": "b.*",
+				"MYPREFIX_a":                      "1",
+				"MYPREFIX_b.c":                    "2",
+			}),
+			WithRegistry(registry),
+			WithFS(memFS{"/template.gorp": &bytes.Buffer{}}),
+		)
+		require.NoError(t, err)
+		err = config.Write()
+		assert.EqualError(t, err, "Strict mode only allows keys in the template file /template.gorp or the strict allow keys, found: a")
+		var keysErr *UnknownKeysError
+		require.True(t, errors.As(err, &keysErr))
+		assert.Equal(t, "/template.gorp", keysErr.Path)
+		assert.Equal(t, []string{"a"}, keysErr.Keys)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		config := Config{
+			Opts:     Opts{File: "/out.txt", Format: "missing"},
+			registry: registry,
+			fs:       memFS{},
+		}
+		err := config.Write()
+		assert.EqualError(t, err, `Unsupported file format: "missing"`)
+		var writeErr *WriteError
+		require.True(t, errors.As(err, &writeErr))
+		assert.Equal(t, "/out.txt", writeErr.Path)
+		var formatErr *UnsupportedFormatError
+		require.True(t, errors.As(err, &formatErr))
+		assert.Equal(t, "missing", formatErr.Format)
+	})
+}
+
+func TestValidationErrors(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterFormat("gorp", &gorpMarshaler{})
+
+	_, err := NewWithOptions("MYPREFIX",
+		WithEnv(map[string]string{
+			"MYPREFIX_OPTS_COMPACT":              "sometimes",
+			"MYPREFIX_OPTS_INDENT":               "none",
+			"MYPREFIX_OPTS_FORMAT":               "missing",
+			"MYPREFIX_OPTS_TEMPLATE_FILE":        "/missing.gorp",
+			"MYPREFIX_OPTS_TEMPLATE_DELETE_KEYS": "a,!b..c",
+			"MYPREFIX_OPTS_IN_port":              "BIND_PORT",
+			"MYPREFIX_A..B":                      "C",
+		}),
+		WithRegistry(registry),
+		WithFS(memFS{}),
+	)
+	assert.EqualError(t, err, `myprefix: 8 problems:
+- required key MYPREFIX_OPTS_FILE missing value
+- envconfig.Process: assigning MYPREFIX_OPTS_COMPACT to Compact: converting 'sometimes' to type bool. details: strconv.ParseBool: parsing "sometimes": invalid syntax
+- Invalid indent "none", must be a number of spaces or 'tab'
+- Missing required environment variables: BIND_PORT
+- Unsupported file format: "missing"
+- file does not exist
+- Invalid key "A..B": column 3: empty key segment
+- Invalid key "b..c": column 3: empty key segment`)
+
+	var validationErrs ValidationErrors
+	require.True(t, errors.As(err, &validationErrs))
+	var inputsErr *MissingInputsError
+	require.True(t, errors.As(err, &inputsErr))
+	assert.Equal(t, []string{"BIND_PORT"}, inputsErr.Variables)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
@@ -0,0 +1,106 @@
+package directive
+
+import (
+	"io"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	env2config.RegisterFormat("directive", &directiveMarshaler{dialect: defaultDialect})
+}
+
+const (
+	delimiterSpace  = "space"
+	delimiterEquals = "="
+
+	quotingAuto   = "auto"
+	quotingAlways = "always"
+)
+
+var defaultDialect = dialect{
+	quote:   '"',
+	quoting: quotingAuto,
+}
+
+// dialect describes the directive syntax to write, set with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	DELIMITER  separates keys and values, either 'space' or '='. Defaults to the template's delimiter, or 'space'.
+//	QUOTE      the quote character, either '"' or "'". Defaults to '"'.
+//	QUOTING    'auto' quotes values only when necessary, 'always' quotes every value. Defaults to 'auto'.
+type dialect struct {
+	delimiter string
+	quote     byte
+	quoting   string
+}
+
+// directiveMarshaler reads and writes 'key value' directives, like redis.conf or sshd_config.
+// Values must be scalars or arrays. Arrays are written as repeated directives, and nested arrays are written as space separated arguments.
+type directiveMarshaler struct {
+	dialect dialect
+}
+
+func (d *directiveMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newDialect := d.dialect
+	for option, value := range options.Format {
+		switch option {
+		case "delimiter":
+			if value != delimiterSpace && value != delimiterEquals {
+				return nil, errors.Errorf("Invalid directive delimiter option %q, must be %q or %q", value, delimiterSpace, delimiterEquals)
+			}
+			newDialect.delimiter = value
+		case "quote":
+			if value != `"` && value != "'" {
+				return nil, errors.Errorf(`Invalid directive quote option %q, must be '"' or "'"`, value)
+			}
+			newDialect.quote = value[0]
+		case "quoting":
+			if value != quotingAuto && value != quotingAlways {
+				return nil, errors.Errorf("Invalid directive quoting option %q, must be %q or %q", value, quotingAuto, quotingAlways)
+			}
+			newDialect.quoting = value
+		default:
+			return nil, errors.Errorf("Unsupported directive format option: %q", option)
+		}
+	}
+	return &directiveMarshaler{dialect: newDialect}, nil
+}
+
+func (d *directiveMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return d.MarshalTemplate(w, value, nil)
+}
+
+func (d *directiveMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return encode(w, value, d.dialect, t)
+}
+
+func (d *directiveMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := d.UnmarshalTemplate(r, dest)
+	return err
+}
+
+// UnmarshalTemplate decodes directives into a map of strings. Repeated directives become arrays.
+func (d *directiveMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	for _, dir := range doc.directives {
+		existing, exists := values[dir.key]
+		switch existing := existing.(type) {
+		case []interface{}:
+			values[dir.key] = append(existing, dir.value)
+		default:
+			if exists {
+				values[dir.key] = []interface{}{existing, dir.value}
+			} else {
+				values[dir.key] = dir.value
+			}
+		}
+	}
+	return newTemplate(doc), internal.SetValue(dest, values)
+}
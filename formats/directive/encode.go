@@ -0,0 +1,162 @@
+package directive
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+// template holds a directive template's order, quoting, and comments, so they can be preserved in the output
+type template struct {
+	lines  *internal.LineTemplate
+	quotes map[string]byte // the quote character of each directive's value, if it was quoted
+	equals bool            // directives are separated by '='
+}
+
+func newTemplate(doc *document) *template {
+	t := &template{
+		lines:  internal.NewLineTemplate(doc.comments),
+		quotes: make(map[string]byte),
+	}
+	if len(doc.directives) > 0 {
+		t.equals = doc.directives[0].equals
+	}
+	for _, dir := range doc.directives {
+		if _, exists := t.lines.Line(dir.key); !exists {
+			t.quotes[dir.key] = dir.quote
+		}
+		t.lines.Add(dir.key, internal.TemplateLine{
+			Comments:    dir.comments,
+			LineComment: dir.lineComment,
+			BlankBefore: dir.blankBefore,
+		})
+	}
+	return t
+}
+
+func (t *template) lineTemplate() *internal.LineTemplate {
+	if t == nil {
+		return nil
+	}
+	return t.lines
+}
+
+func (t *template) quote(key string) byte {
+	if t == nil {
+		return 0
+	}
+	return t.quotes[key]
+}
+
+func encode(w io.Writer, value interface{}, d dialect, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("directive: top-level values must be maps, got %T", value)
+	}
+	if d.delimiter == "" {
+		d.delimiter = delimiterSpace
+		if t != nil && t.equals {
+			d.delimiter = delimiterEquals
+		}
+	}
+	lines := t.lineTemplate()
+	keys := internal.SortedKeys(m)
+	sort.SliceStable(keys, func(a, b int) bool {
+		return lines.Index(keys[a]) < lines.Index(keys[b])
+	})
+
+	lw := lines.NewWriter(w)
+	for _, key := range keys {
+		if m[key] == nil {
+			continue
+		}
+		if key == "" || strings.ContainsAny(key, " \t=#\n") {
+			return errors.Errorf("directive: invalid key %q", key)
+		}
+		keyLines, err := d.directiveLines(key, m[key], t.quote(key))
+		if err != nil {
+			return err
+		}
+		lw.Write(key, keyLines...)
+	}
+	return lw.Flush()
+}
+
+// directiveLines returns a line for 'value', or a line for each element of an array. A non-zero 'quote' always quotes values with that character.
+func (d dialect) directiveLines(key string, value interface{}, quote byte) ([]string, error) {
+	values, isArray := value.([]interface{})
+	if !isArray {
+		values = []interface{}{value}
+	}
+	var lines []string
+	for _, elem := range values {
+		var args []string
+		switch elem := elem.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			return nil, errors.Errorf("directive: %q must be a value or array of values, got a map", key)
+		case []interface{}:
+			for _, arg := range elem {
+				switch arg.(type) {
+				case nil, map[string]interface{}, []interface{}:
+					return nil, errors.Errorf("directive: %q arguments must be values, got %T", key, arg)
+				}
+				args = append(args, d.quoteValue(internal.FormatValue(arg), quote))
+			}
+		default:
+			args = []string{d.quoteValue(internal.FormatValue(elem), quote)}
+		}
+		lines = append(lines, key+d.delimiterStr()+strings.Join(args, " "))
+	}
+	return lines, nil
+}
+
+func (d dialect) delimiterStr() string {
+	if d.delimiter == delimiterEquals {
+		return " = "
+	}
+	return " "
+}
+
+// quoteValue quotes 'value' if the dialect or template requires it, or if it would otherwise be read back differently
+func (d dialect) quoteValue(value string, quote byte) string {
+	needsQuotes := quote != 0 ||
+		d.quoting == quotingAlways ||
+		value == "" ||
+		value != strings.TrimSpace(value) ||
+		strings.ContainsAny(value, "#\n\r\t") ||
+		value[0] == '"' || value[0] == '\''
+	if !needsQuotes {
+		return value
+	}
+	if quote == 0 {
+		quote = d.quote
+	}
+	var result strings.Builder
+	result.WriteByte(quote)
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			result.WriteString(`\\`)
+		case r == '\n':
+			result.WriteString(`\n`)
+		case r == '\r':
+			result.WriteString(`\r`)
+		case r == '\t':
+			result.WriteString(`\t`)
+		case r == rune(quote) && quote == '\'':
+			result.WriteString(`''`)
+		case r == rune(quote):
+			result.WriteString(`\"`)
+		default:
+			result.WriteRune(r)
+		}
+	}
+	result.WriteByte(quote)
+	return result.String()
+}
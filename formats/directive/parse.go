@@ -0,0 +1,130 @@
+package directive
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// document is a parsed directive file, including its comments
+type document struct {
+	directives []directive
+	comments   []string // trailing comments after the last directive
+}
+
+// directive is a parsed 'key value' line, plus its comments
+type directive struct {
+	key         string
+	value       string
+	quote       byte // the quote character if the value was a single quoted string
+	equals      bool // key and value were separated by '='
+	comments    []string
+	lineComment string // a comment after the value, like '# seconds'
+	blankBefore bool   // separated from the previous directive by a blank line
+}
+
+// parse reads 'key value' or 'key = value' lines. Comments start with '#'.
+// A value that is a single quoted string is unquoted, otherwise the rest of the line is the value, like 'save 900 1'.
+func parse(r io.Reader) (*document, error) {
+	scanner := bufio.NewScanner(r)
+	doc := &document{}
+	var comments []string
+	blankBefore := false
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			blankBefore = len(doc.directives) > 0
+			continue
+		case line[0] == '#':
+			comments = append(comments, line)
+			continue
+		}
+		d, err := parseDirective(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid directive on line %d", lineNum)
+		}
+		d.comments = comments
+		d.blankBefore = blankBefore
+		doc.directives = append(doc.directives, d)
+		comments = nil
+		blankBefore = false
+	}
+	doc.comments = comments
+	return doc, scanner.Err()
+}
+
+func parseDirective(line string) (directive, error) {
+	keyEnd := strings.IndexAny(line, " \t=")
+	if keyEnd == -1 {
+		return directive{key: line}, nil
+	}
+	d := directive{key: line[:keyEnd]}
+	rest := strings.TrimLeft(line[keyEnd:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		d.equals = true
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+	if rest == "" {
+		return d, nil
+	}
+
+	if quote := rest[0]; quote == '"' || quote == '\'' {
+		value, end, err := unquote(rest)
+		if err != nil {
+			return directive{}, err
+		}
+		if trailing := strings.TrimSpace(rest[end:]); trailing == "" || trailing[0] == '#' {
+			d.value, d.quote, d.lineComment = value, quote, trailing
+			return d, nil
+		}
+	}
+	d.value, d.lineComment = splitComment(rest)
+	return d, nil
+}
+
+// unquote reads the quoted string at the start of 's' and returns its value and the index after the closing quote.
+// Double quotes use backslash escapes. Single quotes allow a doubled quote, like 'it”s', or backslash escapes.
+func unquote(s string) (string, int, error) {
+	quote := s[0]
+	var value strings.Builder
+	for ix := 1; ix < len(s); ix++ {
+		c := s[ix]
+		switch {
+		case c == '\\' && ix+1 < len(s):
+			ix++
+			switch s[ix] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			default:
+				value.WriteByte(s[ix])
+			}
+		case c == quote && quote == '\'' && ix+1 < len(s) && s[ix+1] == '\'':
+			value.WriteByte(c)
+			ix++
+		case c == quote:
+			return value.String(), ix + 1, nil
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quote")
+}
+
+// splitComment splits a trailing comment, starting with whitespace then '#', from the value before it
+func splitComment(s string) (string, string) {
+	for ix := 1; ix < len(s); ix++ {
+		if s[ix] == '#' && (s[ix-1] == ' ' || s[ix-1] == '\t') {
+			return strings.TrimSpace(s[:ix]), s[ix:]
+		}
+	}
+	return s, ""
+}
@@ -0,0 +1,77 @@
+package dotenv
+
+import (
+	"io"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	env2config.RegisterFormat("dotenv", &dotenvMarshaler{joiner: defaultJoiner})
+	env2config.RegisterFormat("shell", &dotenvMarshaler{joiner: defaultJoiner, shell: true})
+}
+
+const defaultJoiner = "_"
+
+// dotenvMarshaler reads and writes 'KEY=value' lines. Nested keys and array indexes are joined into a single key.
+//
+// The dotenv format double quotes values when necessary, escaping newlines, '$', and quotes.
+// The shell format prefixes each line with 'export' and uses POSIX single quotes, so it can be sourced by sh.
+//
+// Format options, set with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	JOINER  joins nested keys. Defaults to '_'.
+type dotenvMarshaler struct {
+	joiner string
+	shell  bool
+}
+
+func (d *dotenvMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newMarshaler := *d
+	for option, value := range options.Format {
+		switch option {
+		case "joiner":
+			newMarshaler.joiner = value
+		default:
+			return nil, errors.Errorf("Unsupported %s format option: %q", d.formatName(), option)
+		}
+	}
+	return &newMarshaler, nil
+}
+
+func (d *dotenvMarshaler) formatName() string {
+	if d.shell {
+		return "shell"
+	}
+	return "dotenv"
+}
+
+func (d *dotenvMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return d.MarshalTemplate(w, value, nil)
+}
+
+func (d *dotenvMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return d.encode(w, value, t)
+}
+
+func (d *dotenvMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := d.UnmarshalTemplate(r, dest)
+	return err
+}
+
+// UnmarshalTemplate decodes variables into a flat map of strings.
+// Keys aren't split by the joiner, since it usually appears in variable names too.
+func (d *dotenvMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	doc, err := parse(r, d.shell)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{}, len(doc.variables))
+	for _, v := range doc.variables {
+		values[v.key] = v.value
+	}
+	return newTemplate(doc), internal.SetValue(dest, values)
+}
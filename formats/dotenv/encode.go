@@ -0,0 +1,158 @@
+package dotenv
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+var doubleQuoteReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"$", `\$`,
+	"`", "\\`",
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+// template holds a dotenv template's variable order and comments
+type template = internal.LineTemplate
+
+func newTemplate(doc *document) *template {
+	t := internal.NewLineTemplate(doc.comments)
+	for _, v := range doc.variables {
+		t.Add(v.key, internal.TemplateLine{
+			Comments:    v.comments,
+			BlankBefore: v.blankBefore,
+		})
+	}
+	return t
+}
+
+// leaf is a single variable to write
+type leaf struct {
+	key   string
+	value string
+}
+
+func (d *dotenvMarshaler) encode(w io.Writer, value interface{}, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("%s: top-level values must be maps, got %T", d.formatName(), value)
+	}
+	leaves := d.flatten("", m, nil)
+	seen := make(map[string]bool, len(leaves))
+	for _, l := range leaves {
+		if err := d.validateKey(l.key); err != nil {
+			return err
+		}
+		if seen[l.key] {
+			return errors.Errorf("%s: multiple keys are joined into %q", d.formatName(), l.key)
+		}
+		seen[l.key] = true
+	}
+	sort.SliceStable(leaves, func(a, b int) bool {
+		return t.Index(leaves[a].key) < t.Index(leaves[b].key)
+	})
+
+	lw := t.NewWriter(w)
+	for _, l := range leaves {
+		if d.shell {
+			lw.Write(l.key, exportPrefix+l.key+"="+singleQuote(l.value))
+		} else {
+			lw.Write(l.key, l.key+"="+doubleQuote(l.value))
+		}
+	}
+	return lw.Flush()
+}
+
+// flatten returns the scalar values nested in 'value', with map keys sorted and array elements in order
+func (d *dotenvMarshaler) flatten(key string, value interface{}, leaves []leaf) []leaf {
+	switch value := value.(type) {
+	case nil:
+		// variables can't be null, so skip it
+	case map[string]interface{}:
+		for _, k := range internal.SortedKeys(value) {
+			leaves = d.flatten(d.joinKey(key, k), value[k], leaves)
+		}
+	case []interface{}:
+		for ix, elem := range value {
+			leaves = d.flatten(d.joinKey(key, strconv.Itoa(ix)), elem, leaves)
+		}
+	default:
+		leaves = append(leaves, leaf{key: key, value: internal.FormatValue(value)})
+	}
+	return leaves
+}
+
+func (d *dotenvMarshaler) joinKey(key, k string) string {
+	if key == "" {
+		return k
+	}
+	return key + d.joiner + k
+}
+
+// validateKey returns an error if 'key' can't be read back as a variable name
+func (d *dotenvMarshaler) validateKey(key string) error {
+	valid := key != "" && !strings.ContainsAny(key, "=#'\"\\ \t\r\n")
+	if d.shell {
+		valid = isShellName(key)
+	}
+	if !valid {
+		return errors.Errorf("%s: invalid variable name %q", d.formatName(), key)
+	}
+	return nil
+}
+
+// isShellName returns true if 'key' is a valid POSIX shell variable name
+func isShellName(key string) bool {
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return false
+	}
+	for _, r := range key {
+		if !isSafeKeyChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSafeKeyChar(r rune) bool {
+	return (r >= 'A' && r <= 'Z') ||
+		(r >= 'a' && r <= 'z') ||
+		(r >= '0' && r <= '9') ||
+		r == '_'
+}
+
+// needsQuotes returns true if 'value' isn't a single, literal shell word
+func needsQuotes(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !isSafeKeyChar(r) && !strings.ContainsRune("-.,/:@%+=", r) {
+			return true
+		}
+	}
+	return false
+}
+
+func doubleQuote(value string) string {
+	if !needsQuotes(value) {
+		return value
+	}
+	return `"` + doubleQuoteReplacer.Replace(value) + `"`
+}
+
+// singleQuote quotes 'value' for POSIX shells. Single quotes can't be escaped inside single quotes, so they end the quote, add an escaped quote, then start a new one.
+func singleQuote(value string) string {
+	if !needsQuotes(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,148 @@
+package dotenv
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const exportPrefix = "export "
+
+var controlChars = map[byte]byte{'n': '\n', 't': '\t', 'r': '\r'}
+
+// document is a parsed dotenv or shell file, including its comments
+type document struct {
+	variables []variable
+	comments  []string // trailing comments after the last variable
+}
+
+// variable is a parsed assignment, plus the comments above it
+type variable struct {
+	key         string
+	value       string
+	comments    []string
+	blankBefore bool // separated from the previous variable by a blank line
+}
+
+// parse reads 'KEY=value' lines, optionally prefixed by 'export'.
+// Values are read like a single shell word: unquoted, single quoted, or double quoted with backslash escapes.
+// Unless 'shell' is set, double quoted values also expand '\n', '\t', and '\r' like most dotenv parsers.
+func parse(r io.Reader, shell bool) (*document, error) {
+	scanner := bufio.NewScanner(r)
+	doc := &document{}
+	var comments []string
+	blankBefore := false
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			blankBefore = len(doc.variables) > 0
+			continue
+		case line[0] == '#':
+			comments = append(comments, line)
+			continue
+		}
+
+		line = strings.TrimLeft(strings.TrimPrefix(line, exportPrefix), " \t")
+		equals := strings.IndexByte(line, '=')
+		if equals == -1 {
+			return nil, errors.Errorf("Invalid line %d: expected KEY=value: %q", lineNum, line)
+		}
+		key := strings.TrimSpace(line[:equals])
+		value, err := parseValue(line[equals+1:], shell, scanner, &lineNum)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid value for %q on line %d", key, lineNum)
+		}
+		doc.variables = append(doc.variables, variable{
+			key:         key,
+			value:       value,
+			comments:    comments,
+			blankBefore: blankBefore,
+		})
+		comments = nil
+		blankBefore = false
+	}
+	doc.comments = comments
+	return doc, scanner.Err()
+}
+
+// parseValue reads a shell word from 's', continuing onto the next lines for unterminated quotes
+func parseValue(s string, shell bool, scanner *bufio.Scanner, lineNum *int) (string, error) {
+	s = strings.TrimLeft(s, " \t")
+	var value strings.Builder
+	for ix := 0; ix < len(s); ix++ {
+		c := s[ix]
+		switch {
+		case c == ' ' || c == '\t':
+			return value.String(), nil // the rest is whitespace or an inline comment
+		case c == '\\' && ix+1 < len(s):
+			ix++
+			value.WriteByte(s[ix])
+		case c == '\'' || c == '"':
+			end := -1
+			for end == -1 {
+				end = closingQuote(s, ix+1, c)
+				if end != -1 {
+					break
+				}
+				if !scanner.Scan() {
+					return "", errors.New("unterminated quote")
+				}
+				*lineNum++
+				s += "\n" + scanner.Text()
+			}
+			quoted := s[ix+1 : end]
+			if c == '"' {
+				quoted = unescapeDoubleQuoted(quoted, shell)
+			}
+			value.WriteString(quoted)
+			ix = end
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return value.String(), nil
+}
+
+// closingQuote returns the index of the 'quote' ending the string starting at 'start', or -1 if it isn't closed
+func closingQuote(s string, start int, quote byte) int {
+	for ix := start; ix < len(s); ix++ {
+		switch {
+		case quote == '"' && s[ix] == '\\':
+			ix++
+		case s[ix] == quote:
+			return ix
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string, shell bool) string {
+	var result strings.Builder
+	for ix := 0; ix < len(s); ix++ {
+		c := s[ix]
+		if c != '\\' || ix+1 == len(s) {
+			result.WriteByte(c)
+			continue
+		}
+		ix++
+		if control, isControl := controlChars[s[ix]]; isControl && !shell {
+			result.WriteByte(control)
+			continue
+		}
+		switch s[ix] {
+		case '\n':
+			// line continuation
+		case '\\', '"', '$', '`':
+			result.WriteByte(s[ix])
+		default:
+			result.WriteByte('\\')
+			result.WriteByte(s[ix])
+		}
+	}
+	return result.String()
+}
@@ -1,8 +1,14 @@
 package formats
 
 import (
+	_ "github.com/johnstarich/env2config/formats/directive"
+	_ "github.com/johnstarich/env2config/formats/dotenv"
+	_ "github.com/johnstarich/env2config/formats/hcl"
 	_ "github.com/johnstarich/env2config/formats/ini"
 	_ "github.com/johnstarich/env2config/formats/json"
+	_ "github.com/johnstarich/env2config/formats/plist"
+	_ "github.com/johnstarich/env2config/formats/properties"
 	_ "github.com/johnstarich/env2config/formats/toml"
+	_ "github.com/johnstarich/env2config/formats/xml"
 	_ "github.com/johnstarich/env2config/formats/yaml"
 )
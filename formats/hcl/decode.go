@@ -0,0 +1,253 @@
+package hcl
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+type kind int
+
+const (
+	// blockKind writes a map as a block, like 'name { ... }', and an array of maps as repeated blocks
+	blockKind kind = iota + 1
+	// attributeKind writes a map or array of maps as an attribute, like 'name = { ... }'
+	attributeKind
+	// labelKind writes a map's keys as labels of the blocks inside it, like 'name "label" { ... }'
+	labelKind
+)
+
+// template holds an HCL template's block structure, key order, and comments, so they can be preserved in the output
+type template struct {
+	kinds    map[string]kind    // keyed by internal.PathKey() of map keys, excluding array indexes
+	comments map[string]comment // keyed by internal.PathKey() of the value path, including array indexes
+	types    map[string]string  // keyed by internal.PathKey() of the value path, the type tag of number and bool values
+	literals map[string]literal // keyed by internal.PathKey() of the value path, the quoted strings as written
+	order    *internal.KeyOrder
+}
+
+// literal is a quoted string in the template, so unchanged strings keep their original quoting and interpolations
+type literal struct {
+	value string
+	text  string
+}
+
+type comment struct {
+	lead []string
+	line string
+}
+
+func (t *template) kind(path []string) kind {
+	if t == nil {
+		return 0
+	}
+	return t.kinds[internal.PathKey(path)]
+}
+
+func (t *template) keyOrder() *internal.KeyOrder {
+	if t == nil {
+		return nil
+	}
+	return t.order
+}
+
+// typeTag returns the internal type tag of the template's number or bool value at 'path', if any
+func (t *template) typeTag(path []string) string {
+	if t == nil {
+		return ""
+	}
+	return t.types[internal.PathKey(path)]
+}
+
+// literal returns the template's quoted string at 'path', if any
+func (t *template) literal(path []string) (literal, bool) {
+	if t == nil {
+		return literal{}, false
+	}
+	lit, exists := t.literals[internal.PathKey(path)]
+	return lit, exists
+}
+
+func (t *template) comment(path []string) comment {
+	if t == nil {
+		return comment{}
+	}
+	return t.comments[internal.PathKey(path)]
+}
+
+// decode returns the values in 'file' and a template describing its structure.
+// Blocks become maps, block labels become nested maps, and repeated blocks become arrays.
+func decode(file *ast.File) (map[string]interface{}, *template, error) {
+	list, isList := file.Node.(*ast.ObjectList)
+	if !isList {
+		return nil, nil, errors.Errorf("Unexpected top-level HCL node: %T", file.Node)
+	}
+	t := &template{
+		kinds:    make(map[string]kind),
+		comments: make(map[string]comment),
+		types:    make(map[string]string),
+		literals: make(map[string]literal),
+		order:    internal.NewKeyOrder(),
+	}
+	values := make(map[string]interface{})
+	err := t.objectList(list, nil, nil, values, t.order)
+	return values, t, err
+}
+
+// objectList decodes the items in 'list' into 'm'. 'path' is the map key path and 'valuePath' also includes array indexes.
+func (t *template) objectList(list *ast.ObjectList, path, valuePath []string, m map[string]interface{}, order *internal.KeyOrder) error {
+	blockCounts := make(map[string]int)
+	for _, item := range list.Items {
+		if !item.Assign.IsValid() {
+			blockCounts[internal.PathKey(itemKeys(item))]++
+		}
+	}
+	blockIndexes := make(map[string]int)
+
+	for _, item := range list.Items {
+		keys := itemKeys(item)
+		if len(keys) == 0 {
+			continue
+		}
+		itemPath, itemValuePath := path, valuePath
+		target, itemOrder := m, order
+		for _, label := range keys[:len(keys)-1] {
+			itemPath = internal.AppendKey(itemPath, label)
+			itemValuePath = internal.AppendKey(itemValuePath, label)
+			t.kinds[internal.PathKey(itemPath)] = labelKind
+			next, isMap := target[label].(map[string]interface{})
+			if !isMap {
+				if _, exists := target[label]; exists {
+					return errors.Errorf("Block %q conflicts with attribute %q", strings.Join(keys, " "), label)
+				}
+				next = make(map[string]interface{})
+				target[label] = next
+			}
+			target, itemOrder = next, itemOrder.Add(label)
+		}
+		key := keys[len(keys)-1]
+		itemPath = internal.AppendKey(itemPath, key)
+		itemValuePath = internal.AppendKey(itemValuePath, key)
+		itemOrder = itemOrder.Add(key)
+
+		isBlock := !item.Assign.IsValid()
+		repeated := isBlock && blockCounts[internal.PathKey(keys)] > 1
+		if repeated {
+			index := strconv.Itoa(blockIndexes[internal.PathKey(keys)])
+			blockIndexes[internal.PathKey(keys)]++
+			itemValuePath = internal.AppendKey(itemValuePath, index)
+			itemOrder = itemOrder.Add(index)
+		}
+		if isBlock {
+			t.kinds[internal.PathKey(itemPath)] = blockKind
+		}
+		t.addComments(itemValuePath, item.LeadComment, item.LineComment)
+
+		value, err := t.value(item.Val, itemPath, itemValuePath, itemOrder)
+		if err != nil {
+			return err
+		}
+		if !isBlock && isObject(value) {
+			t.kinds[internal.PathKey(itemPath)] = attributeKind
+		}
+		_, exists := target[key]
+		switch {
+		case repeated:
+			array, _ := target[key].([]interface{})
+			target[key] = append(array, value)
+		case isBlock && exists:
+			return errors.Errorf("Block %q conflicts with another block or attribute of the same name", strings.Join(keys, " "))
+		default:
+			target[key] = value
+		}
+	}
+	return nil
+}
+
+func (t *template) value(node ast.Node, path, valuePath []string, order *internal.KeyOrder) (interface{}, error) {
+	switch node := node.(type) {
+	case *ast.ObjectType:
+		m := make(map[string]interface{})
+		return m, t.objectList(node.List, path, valuePath, m, order)
+	case *ast.ListType:
+		values := make([]interface{}, 0, len(node.List))
+		for ix, elem := range node.List {
+			index := strconv.Itoa(ix)
+			value, err := t.value(elem, path, internal.AppendKey(valuePath, index), order.Add(index))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case *ast.LiteralType:
+		value := node.Token.Value()
+		switch typed := value.(type) {
+		case int64:
+			t.types[internal.PathKey(valuePath)] = internal.TagInt
+		case float64:
+			t.types[internal.PathKey(valuePath)] = internal.TagFloat
+		case bool:
+			t.types[internal.PathKey(valuePath)] = internal.TagBool
+		case string:
+			if node.Token.Type == token.STRING {
+				t.literals[internal.PathKey(valuePath)] = literal{value: typed, text: node.Token.Text}
+			}
+		}
+		return value, nil
+	default:
+		return nil, errors.Errorf("Unsupported HCL node: %T", node)
+	}
+}
+
+func (t *template) addComments(path []string, lead, line *ast.CommentGroup) {
+	c := comment{lead: commentLines(lead)}
+	if lines := commentLines(line); len(lines) > 0 {
+		c.line = lines[0]
+	}
+	if len(c.lead) > 0 || c.line != "" {
+		t.comments[internal.PathKey(path)] = c
+	}
+}
+
+func commentLines(group *ast.CommentGroup) []string {
+	if group == nil {
+		return nil
+	}
+	lines := make([]string, len(group.List))
+	for ix, c := range group.List {
+		lines[ix] = c.Text
+	}
+	return lines
+}
+
+func itemKeys(item *ast.ObjectItem) []string {
+	keys := make([]string, len(item.Keys))
+	for ix, key := range item.Keys {
+		keys[ix], _ = key.Token.Value().(string)
+	}
+	return keys
+}
+
+// isObject returns true for maps and arrays of maps
+func isObject(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		if len(v) == 0 {
+			return false
+		}
+		for _, elem := range v {
+			if _, isMap := elem.(map[string]interface{}); !isMap {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
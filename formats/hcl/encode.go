@@ -0,0 +1,292 @@
+package hcl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const indent = "  "
+
+var quotedReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// interpolationReplacer escapes the start of interpolations in new string values, so they're written literally
+var interpolationReplacer = strings.NewReplacer("${", "$${")
+
+type encoder struct {
+	w          *bufio.Writer
+	template   *template
+	attributes []pattern
+	labels     []pattern
+	// startOfBody is true when nothing has been written since the start of the file or a block
+	startOfBody bool
+}
+
+func (h *hclMarshaler) encode(w io.Writer, value interface{}, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("hcl: top-level values must be maps, got %T", value)
+	}
+	e := &encoder{
+		w:           bufio.NewWriter(w),
+		template:    t,
+		attributes:  h.attributes,
+		labels:      h.labels,
+		startOfBody: true,
+	}
+	if err := e.body(nil, nil, m, t.keyOrder(), 0); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *encoder) write(s ...string) {
+	for _, str := range s {
+		_, _ = e.w.WriteString(str)
+	}
+	e.startOfBody = false
+}
+
+// kind returns how the map at 'path' should be written. Format options take precedence over the template, then maps default to blocks.
+func (e *encoder) kind(path []string) kind {
+	switch {
+	case matchAny(e.attributes, path):
+		return attributeKind
+	case matchAny(e.labels, path):
+		return labelKind
+	}
+	if k := e.template.kind(path); k != 0 {
+		return k
+	}
+	return blockKind
+}
+
+// body writes the attributes and blocks in 'm'. Keys from the template keep their order, then new attributes are written before new blocks.
+func (e *encoder) body(path, valuePath []string, m map[string]interface{}, order *internal.KeyOrder, depth int) error {
+	var keys, newBlocks []string
+	for _, key := range order.Keys(m) {
+		switch {
+		case m[key] == nil:
+			// HCL has no null attributes, so skip it
+		case order.Nested(key) == nil && e.isBlock(internal.AppendKey(path, key), m[key]):
+			newBlocks = append(newBlocks, key)
+		default:
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range append(keys, newBlocks...) {
+		keyPath, keyValuePath := internal.AppendKey(path, key), internal.AppendKey(valuePath, key)
+		var err error
+		if e.isBlock(keyPath, m[key]) {
+			err = e.block(keyPath, keyValuePath, []string{key}, m[key], order.Nested(key), depth)
+		} else {
+			err = e.attribute(keyValuePath, key, m[key], order.Nested(key), depth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) isBlock(path []string, value interface{}) bool {
+	return isObject(value) && e.kind(path) != attributeKind
+}
+
+func (e *encoder) attribute(valuePath []string, key string, value interface{}, order *internal.KeyOrder, depth int) error {
+	c := e.template.comment(valuePath)
+	e.comments(c.lead, depth)
+	e.write(strings.Repeat(indent, depth), quoteKey(key), " = ")
+	if err := e.expression(valuePath, value, order, depth); err != nil {
+		return err
+	}
+	e.lineComment(c.line)
+	return nil
+}
+
+// block writes 'value' as a block with a type and labels in 'header'. Arrays are written as repeated blocks.
+func (e *encoder) block(path, valuePath, header []string, value interface{}, order *internal.KeyOrder, depth int) error {
+	if values, isArray := value.([]interface{}); isArray {
+		for ix, elem := range values {
+			index := strconv.Itoa(ix)
+			if err := e.block(path, internal.AppendKey(valuePath, index), header, elem, order.Nested(index), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return errors.Errorf("hcl: block %q must be a map, got %T", strings.Join(path, "."), value)
+	}
+
+	if e.kind(path) == labelKind {
+		for _, label := range order.Keys(m) {
+			labelPath := internal.AppendKey(path, label)
+			switch {
+			case m[label] == nil:
+				continue
+			case !isObject(m[label]):
+				return errors.Errorf("hcl: labeled block %q can only contain blocks, found %q", strings.Join(path, "."), label)
+			}
+			if err := e.block(labelPath, internal.AppendKey(valuePath, label), internal.AppendKey(header, label), m[label], order.Nested(label), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !e.startOfBody {
+		e.write("\n")
+	}
+	c := e.template.comment(valuePath)
+	e.comments(c.lead, depth)
+	e.write(strings.Repeat(indent, depth), quoteKey(header[0]))
+	for _, label := range header[1:] {
+		e.write(" ", quoteString(label))
+	}
+	e.write(" {")
+	e.lineComment(c.line)
+	e.startOfBody = true
+	if err := e.body(path, valuePath, m, order, depth+1); err != nil {
+		return err
+	}
+	e.write(strings.Repeat(indent, depth), "}\n")
+	return nil
+}
+
+// expression writes 'value' at 'valuePath'. Strings replacing the template's numbers and bools keep the template's type.
+func (e *encoder) expression(valuePath []string, value interface{}, order *internal.KeyOrder, depth int) error {
+	if s, isString := value.(string); isString {
+		typed, err := typeString(s, e.template.typeTag(valuePath))
+		if err != nil {
+			return errors.Wrapf(err, "hcl: %s", strings.Join(valuePath, "."))
+		}
+		value = typed
+	}
+	switch value := value.(type) {
+	case nil:
+		e.write("null")
+	case string:
+		if lit, exists := e.template.literal(valuePath); exists && lit.value == value {
+			e.write(lit.text) // unchanged, so keep the template's interpolations
+		} else {
+			e.write(quoteString(interpolationReplacer.Replace(value)))
+		}
+	case bool:
+		e.write(strconv.FormatBool(value))
+	case int:
+		e.write(strconv.Itoa(value))
+	case int64:
+		e.write(strconv.FormatInt(value, 10))
+	case float64:
+		e.write(strconv.FormatFloat(value, 'f', -1, 64))
+	case time.Time:
+		e.write(quoteString(value.Format(time.RFC3339)))
+	case []interface{}:
+		if !containsObjects(value) {
+			e.write("[")
+			for ix, elem := range value {
+				if ix > 0 {
+					e.write(", ")
+				}
+				index := strconv.Itoa(ix)
+				if err := e.expression(internal.AppendKey(valuePath, index), elem, order.Nested(index), depth); err != nil {
+					return err
+				}
+			}
+			e.write("]")
+			return nil
+		}
+		e.write("[\n")
+		for ix, elem := range value {
+			e.write(strings.Repeat(indent, depth+1))
+			index := strconv.Itoa(ix)
+			if err := e.expression(internal.AppendKey(valuePath, index), elem, order.Nested(index), depth+1); err != nil {
+				return err
+			}
+			e.write(",\n")
+		}
+		e.write(strings.Repeat(indent, depth), "]")
+	case map[string]interface{}:
+		if len(value) == 0 {
+			e.write("{}")
+			return nil
+		}
+		e.write("{\n")
+		for _, key := range order.Keys(value) {
+			e.write(strings.Repeat(indent, depth+1), quoteKey(key), " = ")
+			if err := e.expression(internal.AppendKey(valuePath, key), value[key], order.Nested(key), depth+1); err != nil {
+				return err
+			}
+			e.write("\n")
+		}
+		e.write(strings.Repeat(indent, depth), "}")
+	default:
+		return errors.Errorf("hcl: unsupported type %T", value)
+	}
+	return nil
+}
+
+func (e *encoder) comments(lines []string, depth int) {
+	for _, line := range lines {
+		e.write(strings.Repeat(indent, depth), line, "\n")
+	}
+}
+
+func (e *encoder) lineComment(line string) {
+	if line != "" {
+		e.write(" ", line)
+	}
+	e.write("\n")
+}
+
+// typeString parses 's' as the type in its type tag, like '!!int 8080', or as the template's type 'tag'. Otherwise returns 's'.
+func typeString(s, tag string) (interface{}, error) {
+	if typed, tagged, err := internal.ParseTagged(s); tagged {
+		return typed, err
+	}
+	if tag == "" {
+		return s, nil
+	}
+	return internal.ParseAs(tag, s)
+}
+
+func containsObjects(values []interface{}) bool {
+	for _, elem := range values {
+		switch elem.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+func quoteString(s string) string {
+	return `"` + quotedReplacer.Replace(s) + `"`
+}
+
+func quoteKey(key string) string {
+	for ix, r := range key {
+		isIdentStart := (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || r == '_'
+		if !isIdentStart && (ix == 0 || !((r >= '0' && r <= '9') || r == '-')) {
+			return quoteString(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
@@ -0,0 +1,110 @@
+package hcl
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	env2config.RegisterFormat("hcl", &hclMarshaler{})
+}
+
+const anyKey = "*"
+
+// hclMarshaler reads and writes HCL. Maps are written as blocks by default, or as they appear in the template.
+//
+// Format options, set with <name>_OPTS_FORMAT_<option> env vars, are comma separated key paths.
+// Each '*' in a path matches any single key, and array indexes are left out.
+//
+//	ATTRIBUTES  maps to write as object attributes, like 'name = { ... }'
+//	LABELS      maps whose keys are labels for the blocks inside, like 'name "label" { ... }'
+type hclMarshaler struct {
+	attributes []pattern
+	labels     []pattern
+}
+
+// pattern is a key path where '*' matches any key
+type pattern []string
+
+func (h *hclMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newMarshaler := *h
+	for option, value := range options.Format {
+		switch option {
+		case "attributes":
+			newMarshaler.attributes = parsePatterns(value)
+		case "labels":
+			newMarshaler.labels = parsePatterns(value)
+		default:
+			return nil, errors.Errorf("Unsupported hcl format option: %q", option)
+		}
+	}
+	return &newMarshaler, nil
+}
+
+func (h *hclMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return h.MarshalTemplate(w, value, nil)
+}
+
+func (h *hclMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return h.encode(w, value, t)
+}
+
+func (h *hclMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := h.UnmarshalTemplate(r, dest)
+	return err
+}
+
+// UnmarshalTemplate decodes HCL into nested maps. Block labels become nested maps, and repeated blocks become arrays.
+func (h *hclMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parser.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	values, t, err := decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return t, internal.SetValue(dest, values)
+}
+
+func parsePatterns(value string) []pattern {
+	var patterns []pattern
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, strings.Split(p, "."))
+		}
+	}
+	return patterns
+}
+
+func matchAny(patterns []pattern, path []string) bool {
+	for _, p := range patterns {
+		if p.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p pattern) match(path []string) bool {
+	if len(p) != len(path) {
+		return false
+	}
+	for ix, key := range p {
+		if key != anyKey && key != path[ix] {
+			return false
+		}
+	}
+	return true
+}
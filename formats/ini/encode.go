@@ -0,0 +1,187 @@
+package ini
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/env2config/formats/internal"
+)
+
+// template holds an INI template's key order and comments, so they can be preserved in the output
+type template struct {
+	order    *internal.KeyOrder
+	comments map[string]comment // keyed by internal.PathKey()
+}
+
+type comment struct {
+	above  []string
+	inline string
+}
+
+func newTemplate(doc *document, d dialect) *template {
+	t := &template{
+		order:    internal.NewKeyOrder(),
+		comments: make(map[string]comment),
+	}
+	for _, s := range doc.sections {
+		path := d.sectionPath(s.name)
+		order := t.order
+		for _, key := range path {
+			order = order.Add(key)
+		}
+		if len(s.comments) > 0 {
+			t.comments[internal.PathKey(path)] = comment{above: s.comments}
+		}
+		for _, e := range s.entries {
+			key := strings.TrimSuffix(e.key, arrayKeySuffix)
+			order.Add(key)
+			entryPath := internal.PathKey(internal.AppendKey(path, key))
+			if _, exists := t.comments[entryPath]; !exists && (len(e.comments) > 0 || e.inline != "") {
+				t.comments[entryPath] = comment{above: e.comments, inline: e.inline}
+			}
+		}
+	}
+	return t
+}
+
+func (t *template) keyOrder() *internal.KeyOrder {
+	if t == nil {
+		return nil
+	}
+	return t.order
+}
+
+func (t *template) comment(path []string) comment {
+	if t == nil {
+		return comment{}
+	}
+	return t.comments[internal.PathKey(path)]
+}
+
+type encoder struct {
+	w          *bufio.Writer
+	dialect    dialect
+	template   *template
+	hasWritten bool
+}
+
+func encode(w io.Writer, value interface{}, d dialect, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("ini: top-level values must be maps, got %T", value)
+	}
+	e := &encoder{
+		w:        bufio.NewWriter(w),
+		dialect:  d,
+		template: t,
+	}
+	e.section(nil, m, t.keyOrder())
+	return e.w.Flush()
+}
+
+func (e *encoder) write(s ...string) {
+	for _, str := range s {
+		_, _ = e.w.WriteString(str)
+	}
+	e.hasWritten = true
+}
+
+// section writes the keys in 'm' under a section header, then writes any nested maps as sections
+func (e *encoder) section(path []string, m map[string]interface{}, order *internal.KeyOrder) {
+	var keys, subsections []string
+	for _, key := range order.Keys(m) {
+		switch {
+		case m[key] == nil:
+			// INI has no null, so skip it
+		case isSection(m[key]):
+			subsections = append(subsections, key)
+		default:
+			keys = append(keys, key)
+		}
+	}
+
+	if len(path) > 0 && (len(keys) > 0 || len(subsections) == 0) {
+		if e.hasWritten {
+			e.write("\n")
+		}
+		e.comments(e.template.comment(path))
+		e.write("[", e.dialect.sectionName(path), "]\n")
+	}
+	for _, key := range keys {
+		e.keyValue(internal.AppendKey(path, key), m[key])
+	}
+	for _, key := range subsections {
+		subPath := internal.AppendKey(path, key)
+		switch value := m[key].(type) {
+		case map[string]interface{}:
+			e.section(subPath, value, order.Nested(key))
+		case []interface{}:
+			e.section(subPath, arrayToMap(value), order.Nested(key))
+		}
+	}
+}
+
+func (e *encoder) keyValue(path []string, value interface{}) {
+	key := path[len(path)-1]
+	c := e.template.comment(path)
+	e.comments(c)
+	values, isArray := value.([]interface{})
+	if !isArray {
+		e.keyLine(key, value, c.inline)
+		return
+	}
+	if e.dialect.arrays == arraysBrackets {
+		key += arrayKeySuffix
+	}
+	for ix, elem := range values {
+		inline := ""
+		if ix == 0 {
+			inline = c.inline
+		}
+		e.keyLine(key, elem, inline)
+	}
+}
+
+func (e *encoder) keyLine(key string, value interface{}, inline string) {
+	e.write(e.dialect.formatKey(key))
+	if str := internal.FormatValue(value); str != "" {
+		e.write(e.dialect.delimiterStr(), e.dialect.quoteValue(str))
+	}
+	if inline != "" {
+		e.write(" ", inline)
+	}
+	e.write("\n")
+}
+
+func (e *encoder) comments(c comment) {
+	for _, line := range c.above {
+		e.write(line, "\n")
+	}
+}
+
+// isSection returns true if 'v' must be written as a section, rather than a key
+func isSection(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, elem := range v {
+			switch elem.(type) {
+			case map[string]interface{}, []interface{}:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func arrayToMap(a []interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a))
+	for ix, value := range a {
+		m[strconv.Itoa(ix)] = value
+	}
+	return m
+}
@@ -1,61 +1,195 @@
 package ini
 
 import (
-	"bytes"
 	"io"
+	"strings"
 
-	"github.com/BurntSushi/toml"
 	"github.com/johnstarich/env2config"
 	"github.com/johnstarich/env2config/formats/internal"
-	"gopkg.in/ini.v1"
+	"github.com/pkg/errors"
 )
 
 func init() {
-	env2config.RegisterFormat("ini", &iniMarshaler{})
+	env2config.RegisterFormat("ini", &iniMarshaler{dialect: defaultDialect})
 }
 
-type iniMarshaler struct{}
+const (
+	// arraysRepeat writes arrays as a repeated key for each element
+	arraysRepeat = "repeat"
+	// arraysBrackets writes arrays as a repeated key ending in '[]' for each element
+	arraysBrackets = "brackets"
 
-func (*iniMarshaler) Marshal(w io.Writer, value interface{}) error {
-	var buf bytes.Buffer
-	enc := toml.NewEncoder(&buf) // Encode to toml first, since ini library can't handle map types.
-	err := enc.Encode(value)
-	if err != nil {
-		return err
-	}
-	f, err := ini.Load(&buf)
-	if err != nil {
-		return err
+	arrayKeySuffix = "[]"
+	defaultSection = "DEFAULT"
+)
+
+var defaultDialect = dialect{
+	arrays:           arraysRepeat,
+	sectionSeparator: ".",
+	delimiter:        "=",
+}
+
+// dialect describes the INI syntax to write, set with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	ARRAYS             'repeat' or 'brackets'. Defaults to 'repeat'.
+//	SECTION_SEPARATOR  joins nested section names. Defaults to '.'.
+//	DELIMITER          separates keys and values, either '=' or ':'. Defaults to '='.
+type dialect struct {
+	arrays           string
+	sectionSeparator string
+	delimiter        string
+}
+
+type iniMarshaler struct {
+	dialect dialect
+}
+
+func (i *iniMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	d := i.dialect
+	for option, value := range options.Format {
+		switch option {
+		case "arrays":
+			if value != arraysRepeat && value != arraysBrackets {
+				return nil, errors.Errorf("Invalid ini arrays option %q, must be %q or %q", value, arraysRepeat, arraysBrackets)
+			}
+			d.arrays = value
+		case "section_separator":
+			d.sectionSeparator = value
+		case "delimiter":
+			if value != "=" && value != ":" {
+				return nil, errors.Errorf("Invalid ini delimiter option %q, must be '=' or ':'", value)
+			}
+			d.delimiter = value
+		default:
+			return nil, errors.Errorf("Unsupported ini format option: %q", option)
+		}
 	}
-	f = internal.Walk(f, omitEmptyStrings).(*ini.File)
-	_, err = f.WriteToIndent(w, "  ")
+	return &iniMarshaler{dialect: d}, nil
+}
+
+func (i *iniMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return i.MarshalTemplate(w, value, nil)
+}
+
+func (i *iniMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return encode(w, value, i.dialect, t)
+}
+
+func (i *iniMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := i.UnmarshalTemplate(r, dest)
 	return err
 }
 
-func (*iniMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
-	return ini.MapTo(dest, r)
+// UnmarshalTemplate decodes an INI file into nested maps.
+// Keys in the default section are at the top level, and each section is a map. Nested section names become nested maps.
+// Repeated keys and keys ending in '[]' become arrays.
+func (i *iniMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := i.dialect.values(doc)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(doc, i.dialect), internal.SetValue(dest, values)
 }
 
-func omitEmptyStrings(v interface{}) interface{} {
-	switch v := v.(type) {
-	case *ini.File:
-		for _, section := range v.Sections() {
-			_ = internal.Walk(section, omitEmptyStrings)
+// values returns the contents of 'doc' as nested maps.
+// Repeated keys are merged into an array in file order, including a 'key' followed by 'key[]'.
+// Returns an error if a section and a key have the same name.
+func (d dialect) values(doc *document) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	for _, s := range doc.sections {
+		m := root
+		path := d.sectionPath(s.name)
+		for _, key := range path {
+			existing, exists := m[key]
+			next, isMap := existing.(map[string]interface{})
+			if exists && !isMap {
+				return nil, errors.Errorf("Section %q conflicts with key %q", s.name, key)
+			}
+			if !exists {
+				next = make(map[string]interface{})
+				m[key] = next
+			}
+			m = next
 		}
-		return v
-	case *ini.Section:
-		for _, key := range v.Keys() {
-			if key.Value() == "" {
-				// convert empty strings to boolean empty keys
-				_, err := v.NewBooleanKey(key.Name())
-				if err != nil {
-					panic(err)
+		for _, e := range s.entries {
+			key := strings.TrimSuffix(e.key, arrayKeySuffix)
+			existing, exists := m[key]
+			switch existing := existing.(type) {
+			case map[string]interface{}:
+				return nil, errors.Errorf("Key %q conflicts with section %q", e.key, d.sectionName(internal.AppendKey(path, key)))
+			case []interface{}:
+				m[key] = append(existing, e.value)
+			default:
+				switch {
+				case exists:
+					m[key] = []interface{}{existing, e.value}
+				case key != e.key:
+					m[key] = []interface{}{e.value}
+				default:
+					m[key] = e.value
 				}
 			}
-			_ = internal.Walk(key, omitEmptyStrings)
 		}
-		return v
+	}
+	return root, nil
+}
+
+// sectionPath splits a section name into its nested key path
+func (d dialect) sectionPath(name string) []string {
+	if name == "" || name == defaultSection {
+		return nil
+	}
+	if d.sectionSeparator == "" {
+		return []string{name}
+	}
+	return strings.Split(name, d.sectionSeparator)
+}
+
+func (d dialect) sectionName(path []string) string {
+	return strings.Join(path, d.sectionSeparator)
+}
+
+func (d dialect) delimiterStr() string {
+	if d.delimiter == ":" {
+		return ": "
+	}
+	return " " + d.delimiter + " "
+}
+
+func (d dialect) formatKey(key string) string {
+	needsQuotes := key == "" ||
+		key != strings.TrimSpace(key) ||
+		strings.ContainsAny(key, "=:") ||
+		strings.ContainsAny(key[:1], "[;#\"'`")
+	if !needsQuotes {
+		return key
+	}
+	if !strings.ContainsRune(key, '"') {
+		return `"` + key + `"`
+	}
+	return "`" + key + "`"
+}
+
+// quoteValue quotes 'value' if it would otherwise be read back differently
+func (d dialect) quoteValue(value string) string {
+	needsQuotes := value != strings.TrimSpace(value) ||
+		strings.ContainsAny(value, ";#\n") ||
+		isQuote(value[0])
+	switch {
+	case !needsQuotes:
+		return value
+	case strings.ContainsRune(value, '\n'):
+		return multilineQuote + value + multilineQuote
+	case !strings.ContainsRune(value, '"'):
+		return `"` + value + `"`
+	case !strings.ContainsRune(value, '`'):
+		return "`" + value + "`"
 	default:
-		return v
+		return multilineQuote + value + multilineQuote
 	}
 }
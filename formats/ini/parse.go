@@ -0,0 +1,157 @@
+package ini
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const multilineQuote = `"""`
+
+// document is a parsed INI file, including its comments
+type document struct {
+	sections []*section
+}
+
+type section struct {
+	name     string // empty for the default section
+	comments []string
+	entries  []*entry
+}
+
+type entry struct {
+	key      string
+	value    string
+	comments []string
+	inline   string // trailing comment on the same line
+}
+
+// parse reads an INI document. Both '=' and ':' are accepted as delimiters.
+// Comments start with ';' or '#' and apply to the next section or key.
+func parse(r io.Reader) (*document, error) {
+	scanner := bufio.NewScanner(r)
+	defaultSection := &section{}
+	doc := &document{sections: []*section{defaultSection}}
+	current := defaultSection
+	var comments []string
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case line[0] == ';' || line[0] == '#':
+			comments = append(comments, line)
+		case line[0] == '[':
+			end := strings.IndexByte(line, ']')
+			if end == -1 {
+				return nil, errors.Errorf("Invalid section on line %d: %q", lineNum, line)
+			}
+			current = &section{
+				name:     strings.TrimSpace(line[1:end]),
+				comments: comments,
+			}
+			comments = nil
+			doc.sections = append(doc.sections, current)
+		default:
+			e, err := parseEntry(line, scanner, &lineNum)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid key on line %d", lineNum)
+			}
+			e.comments = comments
+			comments = nil
+			current.entries = append(current.entries, e)
+		}
+	}
+	return doc, scanner.Err()
+}
+
+func parseEntry(line string, scanner *bufio.Scanner, lineNum *int) (*entry, error) {
+	key, rest, err := parseKey(line)
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{key: key}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return e, nil
+	}
+	if rest[0] != '=' && rest[0] != ':' {
+		return nil, errors.Errorf("expected '=' or ':' after key %q", key)
+	}
+	rest = strings.TrimSpace(rest[1:]) // skip delimiter
+
+	if strings.HasPrefix(rest, multilineQuote) {
+		rest = rest[len(multilineQuote):]
+		var value strings.Builder
+		for {
+			if end := strings.Index(rest, multilineQuote); end != -1 {
+				value.WriteString(rest[:end])
+				e.value = value.String()
+				e.inline = inlineComment(rest[end+len(multilineQuote):])
+				return e, nil
+			}
+			value.WriteString(rest)
+			value.WriteRune('\n')
+			if !scanner.Scan() {
+				return nil, errors.New("unterminated multiline value")
+			}
+			*lineNum++
+			rest = scanner.Text()
+		}
+	}
+
+	if rest != "" && isQuote(rest[0]) {
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end == -1 {
+			return nil, errors.New("unterminated quote")
+		}
+		e.value = rest[1 : end+1]
+		e.inline = inlineComment(rest[end+2:])
+		return e, nil
+	}
+
+	e.value = rest
+	for ix := 1; ix < len(rest); ix++ {
+		if isComment(rest[ix]) && (rest[ix-1] == ' ' || rest[ix-1] == '\t') {
+			e.value = strings.TrimSpace(rest[:ix])
+			e.inline = rest[ix:]
+			break
+		}
+	}
+	return e, nil
+}
+
+// parseKey returns the key at the start of 'line' and the rest of the line, starting with the delimiter
+func parseKey(line string) (key, rest string, err error) {
+	if isQuote(line[0]) {
+		end := strings.IndexByte(line[1:], line[0])
+		if end == -1 {
+			return "", "", errors.New("unterminated quote")
+		}
+		return line[1 : end+1], line[end+2:], nil
+	}
+	end := strings.IndexAny(line, "=:")
+	if end == -1 {
+		return line, "", nil
+	}
+	return strings.TrimSpace(line[:end]), line[end:], nil
+}
+
+func inlineComment(s string) string {
+	s = strings.TrimSpace(s)
+	if s != "" && isComment(s[0]) {
+		return s
+	}
+	return ""
+}
+
+func isQuote(b byte) bool {
+	return b == '"' || b == '\'' || b == '`'
+}
+
+func isComment(b byte) bool {
+	return b == ';' || b == '#'
+}
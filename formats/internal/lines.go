@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineTemplate holds the key order and comments of a line-based template, like properties or dotenv files, so they can be preserved in the output.
+//
+// A nil *LineTemplate is valid and has no keys or comments.
+type LineTemplate struct {
+	lines    map[string]TemplateLine
+	comments []string
+}
+
+// TemplateLine is the first line of a key in a LineTemplate
+type TemplateLine struct {
+	Comments    []string // full-line comments above the line
+	LineComment string   // a comment at the end of the line
+	BlankBefore bool     // separated from the previous line by a blank line
+	index       int
+}
+
+// NewLineTemplate returns an empty LineTemplate, with 'trailingComments' after its last line
+func NewLineTemplate(trailingComments []string) *LineTemplate {
+	return &LineTemplate{
+		lines:    make(map[string]TemplateLine),
+		comments: trailingComments,
+	}
+}
+
+// Add appends 'line' for 'key', unless 'key' was already added
+func (t *LineTemplate) Add(key string, line TemplateLine) {
+	if _, exists := t.lines[key]; !exists {
+		line.index = len(t.lines)
+		t.lines[key] = line
+	}
+}
+
+// Line returns the template's line for 'key', if it exists
+func (t *LineTemplate) Line(key string) (TemplateLine, bool) {
+	if t == nil {
+		return TemplateLine{}, false
+	}
+	line, exists := t.lines[key]
+	return line, exists
+}
+
+// Index returns the position of 'key' in the template. Keys not in the template come last.
+func (t *LineTemplate) Index(key string) int {
+	if t == nil {
+		return 0
+	}
+	line, exists := t.lines[key]
+	if !exists {
+		return len(t.lines)
+	}
+	return line.index
+}
+
+// NewWriter returns a LineWriter for writing lines to 'w' with the template's comments
+func (t *LineTemplate) NewWriter(w io.Writer) *LineWriter {
+	return &LineWriter{w: bufio.NewWriter(w), template: t}
+}
+
+// LineWriter writes the lines of a line-based format, with the comments and blank lines of its template
+type LineWriter struct {
+	w        *bufio.Writer
+	template *LineTemplate
+	written  bool
+}
+
+// Write writes the lines for the template's 'key', preceded by the key's comments. The key's line comment ends the first line.
+func (l *LineWriter) Write(key string, lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	line, _ := l.template.Line(key)
+	if line.BlankBefore && l.written {
+		_, _ = l.w.WriteString("\n")
+	}
+	for _, comment := range line.Comments {
+		_, _ = l.w.WriteString(comment + "\n")
+	}
+	for ix, s := range lines {
+		if ix == 0 && line.LineComment != "" {
+			s += " " + line.LineComment
+		}
+		_, _ = l.w.WriteString(s + "\n")
+	}
+	l.written = true
+}
+
+// Flush writes the template's trailing comments, then flushes the underlying writer
+func (l *LineWriter) Flush() error {
+	if l.template != nil {
+		for _, comment := range l.template.comments {
+			_, _ = l.w.WriteString(comment + "\n")
+		}
+	}
+	return l.w.Flush()
+}
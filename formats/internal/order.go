@@ -0,0 +1,65 @@
+package internal
+
+import "sort"
+
+// KeyOrder is the order of keys in a template's maps, including any maps nested inside.
+// Array elements are nested by their index, e.g. "0".
+//
+// A nil *KeyOrder is valid and sorts all keys.
+type KeyOrder struct {
+	keys   []string
+	nested map[string]*KeyOrder
+}
+
+// NewKeyOrder returns an empty KeyOrder
+func NewKeyOrder() *KeyOrder {
+	return &KeyOrder{nested: make(map[string]*KeyOrder)}
+}
+
+// Add appends 'key' if it isn't present yet, then returns the order for values nested under it
+func (o *KeyOrder) Add(key string) *KeyOrder {
+	nested, exists := o.nested[key]
+	if !exists {
+		nested = NewKeyOrder()
+		o.keys = append(o.keys, key)
+		o.nested[key] = nested
+	}
+	return nested
+}
+
+// Nested returns the order for values nested under 'key', or nil if 'key' wasn't in the template
+func (o *KeyOrder) Nested(key string) *KeyOrder {
+	if o == nil {
+		return nil
+	}
+	return o.nested[key]
+}
+
+// Keys returns the keys of 'm' in output order.
+// Keys from the template come first in their original order, then any new keys are sorted.
+func (o *KeyOrder) Keys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool, len(m))
+	if o != nil {
+		for _, key := range o.keys {
+			if _, exists := m[key]; exists {
+				keys = append(keys, key)
+				seen[key] = true
+			}
+		}
+	}
+	templateKeys := len(keys)
+	for key := range m {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys[templateKeys:])
+	return keys
+}
+
+// SortedKeys returns the keys of 'm' in sorted order
+func SortedKeys(m map[string]interface{}) []string {
+	var order *KeyOrder
+	return order.Keys(m)
+}
@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+)
+
+// WriteOutput writes 'b' to 'w', removing its trailing newlines if 'omitTrailingNewline' is set
+func WriteOutput(w io.Writer, b []byte, omitTrailingNewline bool) error {
+	if omitTrailingNewline {
+		b = bytes.TrimRight(b, "\n")
+	}
+	_, err := w.Write(b)
+	return err
+}
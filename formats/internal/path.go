@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PathKey joins a key path into a single map key, for indexing values by their path
+func PathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// AppendKey returns a copy of 'path' with 'key' appended, so sibling paths don't share a backing array
+func AppendKey(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
+
+// FormatValue returns the text of a scalar value for formats without types. Nil is empty.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
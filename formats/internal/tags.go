@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Type tags set a value's type explicitly in formats with typed values, like 'MYCONF_port=!!int 8080'
+const (
+	TagString   = "!!str"
+	TagInt      = "!!int"
+	TagFloat    = "!!float"
+	TagBool     = "!!bool"
+	TagDatetime = "!!datetime"
+)
+
+// ParseTagged parses 's' as the type in its tag prefix, like '!!int 8080'. Returns false if 's' does not start with one of the Tag constants.
+func ParseTagged(s string) (interface{}, bool, error) {
+	for _, tag := range []string{TagString, TagInt, TagFloat, TagBool, TagDatetime} {
+		if strings.HasPrefix(s, tag+" ") {
+			value, err := ParseAs(tag, strings.TrimPrefix(s, tag+" "))
+			return value, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// ParseAs parses 's' as the type for 'tag'. Integers are int64, floats are float64, and datetimes are RFC 3339 time.Time.
+func ParseAs(tag, s string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch tag {
+	case TagString:
+		return s, nil
+	case TagInt:
+		value, err = strconv.ParseInt(s, 0, 64)
+	case TagFloat:
+		value, err = strconv.ParseFloat(s, 64)
+	case TagBool:
+		value, err = strconv.ParseBool(s)
+	case TagDatetime:
+		value, err = time.Parse(time.RFC3339Nano, s)
+	default:
+		return nil, errors.Errorf("unknown type tag %q", tag)
+	}
+	if err != nil {
+		return nil, errors.Errorf("invalid %s value %q", tag, s)
+	}
+	return value, nil
+}
+
+// TypeStrings replaces the strings in 'value' with the result of 'typeString', which receives the value at the same key path in 'tmpl', if any
+func TypeStrings(value, tmpl interface{}, typeString func(s string, tmpl interface{}) (interface{}, error)) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		tmplMap, _ := tmpl.(map[string]interface{})
+		newMap := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			typed, err := TypeStrings(elem, tmplMap[key], typeString)
+			if err != nil {
+				return nil, err
+			}
+			newMap[key] = typed
+		}
+		return newMap, nil
+	case []interface{}:
+		tmplSlice, _ := tmpl.([]interface{})
+		newSlice := make([]interface{}, len(value))
+		for ix, elem := range value {
+			var tmplElem interface{}
+			if ix < len(tmplSlice) {
+				tmplElem = tmplSlice[ix]
+			}
+			typed, err := TypeStrings(elem, tmplElem, typeString)
+			if err != nil {
+				return nil, err
+			}
+			newSlice[ix] = typed
+		}
+		return newSlice, nil
+	case string:
+		return typeString(value, tmpl)
+	default:
+		return value, nil
+	}
+}
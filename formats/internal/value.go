@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// SetValue assigns 'value' to the pointer 'dest', like a decoder would
+func SetValue(dest interface{}, value interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+		return errors.Errorf("Destination must be a non-nil pointer, got %T", dest)
+	}
+	elem := destValue.Elem()
+	if value == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if !v.Type().AssignableTo(elem.Type()) {
+		return errors.Errorf("Cannot decode %T into %T", value, dest)
+	}
+	elem.Set(v)
+	return nil
+}
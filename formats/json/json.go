@@ -1,25 +1,155 @@
 package json
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"strconv"
 
 	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
 )
 
+const defaultIndent = "\t"
+
 func init() {
 	env2config.RegisterFormat("json", &jsonMarshaler{})
+	env2config.RegisterFormat("jsonc", &jsoncMarshaler{comments: true})
+	env2config.RegisterAlias("json5", "jsonc")
 }
 
-type jsonMarshaler struct{}
+type jsonMarshaler struct {
+	style env2config.Style
+}
 
-func (*jsonMarshaler) Marshal(w io.Writer, value interface{}) error {
-	enc := json.NewEncoder(w)
+func (j *jsonMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	for option := range options.Format {
+		return nil, errors.Errorf("Unsupported json format option: %q", option)
+	}
+	return &jsonMarshaler{style: options.Style}, nil
+}
+
+func (j *jsonMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return j.MarshalTemplate(w, value, nil)
+}
+
+func (j *jsonMarshaler) MarshalTemplate(w io.Writer, value interface{}, template interface{}) error {
+	order, _ := template.(*internal.KeyOrder)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 	enc.SetEscapeHTML(false)
-	enc.SetIndent("", "\t")
-	return enc.Encode(value)
+	if !j.style.Compact {
+		indent := j.style.Indent
+		if indent == "" {
+			indent = defaultIndent
+		}
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(orderedValue(value, order)); err != nil {
+		return err
+	}
+	return internal.WriteOutput(w, buf.Bytes(), j.style.OmitTrailingNewline)
+}
+
+func (j *jsonMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := j.UnmarshalTemplate(r, dest)
+	return err
 }
 
-func (*jsonMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
-	return json.NewDecoder(r).Decode(dest)
+func (*jsonMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	order := internal.NewKeyOrder()
+	value, err := decodeOrdered(dec, order)
+	if err != nil {
+		return nil, err
+	}
+	return order, internal.SetValue(dest, value)
+}
+
+// decodeOrdered decodes the next JSON value from 'dec' and records its key order in 'order'
+func decodeOrdered(dec *json.Decoder, order *internal.KeyOrder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		m := make(map[string]interface{})
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, isString := keyToken.(string)
+			if !isString {
+				return nil, errors.Errorf("Invalid object key: %v", keyToken)
+			}
+			m[key], err = decodeOrdered(dec, order.Add(key))
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err := dec.Token() // consume '}'
+		return m, err
+	case json.Delim('['):
+		var a []interface{}
+		for dec.More() {
+			value, err := decodeOrdered(dec, order.Add(strconv.Itoa(len(a))))
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+		if a == nil {
+			a = []interface{}{}
+		}
+		_, err := dec.Token() // consume ']'
+		return a, err
+	default:
+		return token, nil
+	}
+}
+
+// orderedValue wraps maps in 'v' to encode their keys in 'order'
+func orderedValue(v interface{}, order *internal.KeyOrder) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return orderedMap{value: v, order: order}
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for ix, value := range v {
+			values[ix] = orderedValue(value, order.Nested(strconv.Itoa(ix)))
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+type orderedMap struct {
+	value map[string]interface{}
+	order *internal.KeyOrder
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteRune('{')
+	for ix, key := range m.order.Keys(m.value) {
+		if ix > 0 {
+			buf.WriteRune(',')
+		}
+		if err := enc.Encode(key); err != nil {
+			return nil, err
+		}
+		buf.WriteRune(':')
+		if err := enc.Encode(orderedValue(m.value[key], m.order.Nested(key))); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteRune('}')
+	return buf.Bytes(), nil
 }
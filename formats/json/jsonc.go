@@ -0,0 +1,220 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+// jsoncMarshaler reads JSON templates with comments, trailing commas, and the rest of JSON5, then writes JSON with the template's comments.
+// Comments are controlled with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	COMMENTS  'false' writes plain JSON without the template's comments. Defaults to 'true'.
+type jsoncMarshaler struct {
+	style    env2config.Style
+	comments bool
+}
+
+// commentTemplate holds a JSON5 template's key order and comments, so they can be preserved in the output
+type commentTemplate struct {
+	order    *internal.KeyOrder
+	comments map[string]*comment // keyed by internal.PathKey()
+	trailing []string
+}
+
+type comment struct {
+	head []string // lines above the value
+	line string   // after the value, on the same line
+	foot []string // lines after the last element of an object or array
+}
+
+func (t *commentTemplate) add(path []string) *comment {
+	key := internal.PathKey(path)
+	c, exists := t.comments[key]
+	if !exists {
+		c = &comment{}
+		t.comments[key] = c
+	}
+	return c
+}
+
+func (t *commentTemplate) comment(path []string) comment {
+	if t == nil || t.comments[internal.PathKey(path)] == nil {
+		return comment{}
+	}
+	return *t.comments[internal.PathKey(path)]
+}
+
+func (t *commentTemplate) keyOrder() *internal.KeyOrder {
+	if t == nil {
+		return nil
+	}
+	return t.order
+}
+
+func (t *commentTemplate) trailingComments() []string {
+	if t == nil {
+		return nil
+	}
+	return t.trailing
+}
+
+func (j *jsoncMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newMarshaler := &jsoncMarshaler{style: options.Style, comments: j.comments}
+	for option, value := range options.Format {
+		switch option {
+		case "comments":
+			comments, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("Invalid json comments option %q, must be true or false", value)
+			}
+			newMarshaler.comments = comments
+		default:
+			return nil, errors.Errorf("Unsupported json format option: %q", option)
+		}
+	}
+	return newMarshaler, nil
+}
+
+func (j *jsoncMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return j.MarshalTemplate(w, value, nil)
+}
+
+// MarshalTemplate writes 'value' as indented JSON with the template's comments. Compact output leaves out comments.
+func (j *jsoncMarshaler) MarshalTemplate(w io.Writer, value interface{}, template interface{}) error {
+	t, _ := template.(*commentTemplate)
+	if !j.comments || j.style.Compact {
+		plain := &jsonMarshaler{style: j.style}
+		return plain.MarshalTemplate(w, value, t.keyOrder())
+	}
+	enc := &commentEncoder{
+		indent:   j.style.Indent,
+		template: t,
+	}
+	if enc.indent == "" {
+		enc.indent = defaultIndent
+	}
+	if err := enc.encode(value); err != nil {
+		return err
+	}
+	return internal.WriteOutput(w, enc.buf.Bytes(), j.style.OmitTrailingNewline)
+}
+
+func (j *jsoncMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := j.UnmarshalTemplate(r, dest)
+	return err
+}
+
+func (*jsoncMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	value, template, err := parseJSON5(r)
+	if err != nil {
+		return nil, err
+	}
+	return template, internal.SetValue(dest, value)
+}
+
+// commentEncoder writes indented JSON, like json.Encoder, plus comments from a template
+type commentEncoder struct {
+	buf      bytes.Buffer
+	indent   string
+	template *commentTemplate
+}
+
+func (e *commentEncoder) encode(value interface{}) error {
+	c := e.template.comment(nil)
+	e.lines(c.head, 0)
+	if err := e.value(value, nil, e.template.keyOrder(), 0); err != nil {
+		return err
+	}
+	e.lineComment(c.line)
+	e.buf.WriteString("\n")
+	e.lines(e.template.trailingComments(), 0)
+	return nil
+}
+
+func (e *commentEncoder) value(value interface{}, path []string, order *internal.KeyOrder, depth int) error {
+	var keys []string
+	var elems []interface{}
+	openBracket, closeBracket := "{", "}"
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys = order.Keys(value)
+		for _, key := range keys {
+			elems = append(elems, value[key])
+		}
+	case []interface{}:
+		openBracket, closeBracket = "[", "]"
+		elems = value
+	default:
+		return e.scalar(value)
+	}
+
+	foot := e.template.comment(path).foot
+	if len(elems) == 0 && len(foot) == 0 {
+		e.buf.WriteString(openBracket + closeBracket)
+		return nil
+	}
+	e.buf.WriteString(openBracket + "\n")
+	for ix, elem := range elems {
+		key := strconv.Itoa(ix)
+		if keys != nil {
+			key = keys[ix]
+		}
+		elemPath := internal.AppendKey(path, key)
+		c := e.template.comment(elemPath)
+		e.lines(c.head, depth+1)
+		e.writeIndent(depth + 1)
+		if keys != nil {
+			if err := e.scalar(key); err != nil {
+				return err
+			}
+			e.buf.WriteString(": ")
+		}
+		if err := e.value(elem, elemPath, order.Nested(key), depth+1); err != nil {
+			return err
+		}
+		if ix < len(elems)-1 {
+			e.buf.WriteString(",")
+		}
+		e.lineComment(c.line)
+		e.buf.WriteString("\n")
+	}
+	e.lines(foot, depth+1)
+	e.writeIndent(depth)
+	e.buf.WriteString(closeBracket)
+	return nil
+}
+
+func (e *commentEncoder) scalar(value interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return err
+	}
+	e.buf.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return nil
+}
+
+func (e *commentEncoder) lines(lines []string, depth int) {
+	for _, line := range lines {
+		e.writeIndent(depth)
+		e.buf.WriteString(line + "\n")
+	}
+}
+
+func (e *commentEncoder) lineComment(comment string) {
+	if comment != "" {
+		e.buf.WriteString(" " + comment)
+	}
+}
+
+func (e *commentEncoder) writeIndent(depth int) {
+	e.buf.WriteString(strings.Repeat(e.indent, depth))
+}
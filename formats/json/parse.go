@@ -0,0 +1,395 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// parser reads JSON5, a superset of JSON and JSONC, and records its key order and comments
+type parser struct {
+	src      []byte
+	pos      int
+	template *commentTemplate
+	pending  []string // comments which aren't attached to a value yet
+	lastPath []string // the last value read, for comments on the same line
+	hasLast  bool
+	newline  bool // a newline was read since the last value
+}
+
+func parseJSON5(r io.Reader) (interface{}, *commentTemplate, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &parser{
+		src: bytes.TrimPrefix(src, []byte("\ufeff")),
+		template: &commentTemplate{
+			order:    internal.NewKeyOrder(),
+			comments: make(map[string]*comment),
+		},
+	}
+	value, err := p.value(nil, p.template.order)
+	if err == nil {
+		err = p.skipSpace()
+	}
+	if err == nil && p.pos < len(p.src) {
+		err = p.errorf("unexpected %q after the top-level value", p.src[p.pos])
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	p.template.trailing = p.takePending()
+	return value, p.template, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 1 + bytes.Count(p.src[:p.pos], []byte("\n"))
+	column := p.pos + 1 - (bytes.LastIndexByte(p.src[:p.pos], '\n') + 1)
+	return errors.Errorf("Invalid JSON5 on line %d, column %d: "+format, append([]interface{}{line, column}, args...)...)
+}
+
+func (p *parser) peek() (byte, error) {
+	if err := p.skipSpace(); err != nil {
+		return 0, err
+	}
+	if p.pos >= len(p.src) {
+		return 0, p.errorf("unexpected end of input")
+	}
+	return p.src[p.pos], nil
+}
+
+// skipSpace skips whitespace and comments. Comments on the same line as the last value are attached to it.
+func (p *parser) skipSpace() error {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.newline = true
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f':
+			p.pos++
+		case bytes.HasPrefix(p.src[p.pos:], []byte("//")):
+			end := bytes.IndexByte(p.src[p.pos:], '\n')
+			if end == -1 {
+				end = len(p.src) - p.pos
+			}
+			p.addComment(strings.TrimSpace(string(p.src[p.pos : p.pos+end])))
+			p.pos += end
+		case bytes.HasPrefix(p.src[p.pos:], []byte("/*")):
+			end := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+			if end == -1 {
+				return p.errorf("unterminated comment")
+			}
+			end += 4
+			p.addComment(string(p.src[p.pos : p.pos+end]))
+			p.pos += end
+		default:
+			r, size := utf8.DecodeRune(p.src[p.pos:])
+			if !unicode.IsSpace(r) {
+				return nil
+			}
+			p.pos += size
+		}
+	}
+	return nil
+}
+
+func (p *parser) addComment(text string) {
+	if !p.hasLast || p.newline {
+		p.pending = append(p.pending, text)
+		return
+	}
+	c := p.template.add(p.lastPath)
+	if c.line != "" {
+		c.line += " "
+	}
+	c.line += text
+}
+
+func (p *parser) takePending() []string {
+	pending := p.pending
+	p.pending = nil
+	return pending
+}
+
+func (p *parser) value(path []string, order *internal.KeyOrder) (interface{}, error) {
+	c, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if head := p.takePending(); len(head) > 0 {
+		comment := p.template.add(path)
+		comment.head = append(comment.head, head...)
+	}
+
+	var value interface{}
+	switch c {
+	case '{':
+		value, err = p.object(path, order)
+	case '[':
+		value, err = p.array(path, order)
+	case '"', '\'':
+		value, err = p.string()
+	default:
+		value, err = p.literal()
+	}
+	p.lastPath, p.hasLast, p.newline = path, true, false
+	return value, err
+}
+
+func (p *parser) object(path []string, order *internal.KeyOrder) (interface{}, error) {
+	p.pos++ // consume '{'
+	p.hasLast = false
+	m := make(map[string]interface{})
+	for {
+		c, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' {
+			p.pos++
+			p.addFoot(path)
+			return m, nil
+		}
+
+		head := p.takePending()
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if c, err := p.peek(); err != nil {
+			return nil, err
+		} else if c != ':' {
+			return nil, p.errorf("expected ':' after key %q", key)
+		}
+		p.pos++
+		keyPath := internal.AppendKey(path, key)
+		if len(head) > 0 {
+			p.template.add(keyPath).head = head
+		}
+		m[key], err = p.value(keyPath, order.Add(key))
+		if err != nil {
+			return nil, err
+		}
+		if err := p.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) array(path []string, order *internal.KeyOrder) (interface{}, error) {
+	p.pos++ // consume '['
+	p.hasLast = false
+	a := []interface{}{}
+	for {
+		c, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == ']' {
+			p.pos++
+			p.addFoot(path)
+			return a, nil
+		}
+
+		index := strconv.Itoa(len(a))
+		value, err := p.value(internal.AppendKey(path, index), order.Add(index))
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, value)
+		if err := p.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes a ',' or stops before the closing bracket 'end'. Trailing commas are allowed.
+func (p *parser) separator(end byte) error {
+	c, err := p.peek()
+	switch {
+	case err != nil:
+		return err
+	case c == ',':
+		p.pos++
+		return nil
+	case c == end:
+		return nil
+	default:
+		return p.errorf("expected ',' or %q, found %q", end, c)
+	}
+}
+
+func (p *parser) addFoot(path []string) {
+	if foot := p.takePending(); len(foot) > 0 {
+		p.template.add(path).foot = foot
+	}
+}
+
+// key reads a quoted key or an identifier, like 'name' in '{name: "value"}'
+func (p *parser) key() (string, error) {
+	if c := p.src[p.pos]; c == '"' || c == '\'' {
+		return p.string()
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRune(p.src[p.pos:])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		p.pos += size
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a key, found %q", p.src[p.pos])
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+// string reads a double or single quoted string
+func (p *parser) string() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var s strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return s.String(), nil
+		case c == '\n':
+			return "", p.errorf("unescaped newline in string")
+		case c != '\\':
+			s.WriteByte(c)
+		case p.pos < len(p.src):
+			if err := p.escape(&s); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) escape(s *strings.Builder) error {
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		s.WriteByte('\b')
+	case 'f':
+		s.WriteByte('\f')
+	case 'n':
+		s.WriteByte('\n')
+	case 'r':
+		s.WriteByte('\r')
+	case 't':
+		s.WriteByte('\t')
+	case 'v':
+		s.WriteByte('\v')
+	case '0':
+		s.WriteByte(0)
+	case '\r', '\n':
+		// line continuation
+		if c == '\r' && p.pos < len(p.src) && p.src[p.pos] == '\n' {
+			p.pos++
+		}
+	case 'x':
+		r, err := p.hex(2)
+		if err != nil {
+			return err
+		}
+		s.WriteRune(r)
+	case 'u':
+		r, err := p.hex(4)
+		if err != nil {
+			return err
+		}
+		if utf16.IsSurrogate(r) && bytes.HasPrefix(p.src[p.pos:], []byte(`\u`)) {
+			p.pos += 2
+			low, err := p.hex(4)
+			if err != nil {
+				return err
+			}
+			r = utf16.DecodeRune(r, low)
+		}
+		s.WriteRune(r)
+	default:
+		s.WriteByte(c)
+	}
+	return nil
+}
+
+func (p *parser) hex(digits int) (rune, error) {
+	if p.pos+digits > len(p.src) {
+		return 0, p.errorf("invalid escape sequence")
+	}
+	value, err := strconv.ParseUint(string(p.src[p.pos:p.pos+digits]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid escape sequence")
+	}
+	p.pos += digits
+	return rune(value), nil
+}
+
+// literal reads a boolean, null, or number. Numbers are returned as json.Number, like the json format.
+func (p *parser) literal() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isLiteralChar(p.src[p.pos]) {
+		p.pos++
+	}
+	token := string(p.src[start:p.pos])
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		p.pos = start
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+
+	number := strings.TrimPrefix(token, "+")
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign, number = "-", number[1:]
+	}
+	if strings.HasPrefix(number, "0x") || strings.HasPrefix(number, "0X") {
+		i, err := strconv.ParseUint(number[2:], 16, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", token)
+		}
+		return json.Number(sign + strconv.FormatUint(i, 10)), nil
+	}
+	if strings.HasPrefix(number, ".") {
+		number = "0" + number
+	}
+	number = strings.Replace(number, ".e", "e", 1)
+	number = strings.Replace(number, ".E", "E", 1)
+	number = strings.TrimSuffix(number, ".")
+	if !numberPattern.MatchString(sign + number) {
+		p.pos = start
+		return nil, p.errorf("invalid value %q, JSON values must be strings, finite numbers, booleans, or null", token)
+	}
+	return json.Number(sign + number), nil
+}
+
+func isLiteralChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '+' || c == '-' || c == '.' || c == '_' || c == '$'
+}
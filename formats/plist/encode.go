@@ -0,0 +1,106 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultIndent = "\t"
+	header        = xml.Header + `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n"
+)
+
+// encoder writes XML property lists in the same layout as Apple's tools, with the top-level value unindented inside <plist>
+type encoder struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+func (e *encoder) encode(value interface{}, order *internal.KeyOrder) error {
+	if _, isMap := value.(map[string]interface{}); !isMap {
+		return errors.New("plist: top-level values must be maps")
+	}
+	e.buf.WriteString(header)
+	e.buf.WriteString(`<plist version="1.0">` + "\n")
+	if err := e.value(value, order, 0); err != nil {
+		return err
+	}
+	e.buf.WriteString("</plist>\n")
+	return nil
+}
+
+func (e *encoder) line(depth int, s ...string) {
+	e.buf.WriteString(strings.Repeat(e.indent, depth))
+	for _, str := range s {
+		e.buf.WriteString(str)
+	}
+	e.buf.WriteString("\n")
+}
+
+func (e *encoder) value(value interface{}, order *internal.KeyOrder, depth int) error {
+	switch value := value.(type) {
+	case nil:
+		return errors.New("plist: cannot encode array with nil element")
+	case map[string]interface{}:
+		var keys []string
+		for _, key := range order.Keys(value) {
+			if value[key] != nil { // plists have no null, so skip it
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			e.line(depth, "<dict/>")
+			return nil
+		}
+		e.line(depth, "<dict>")
+		for _, key := range keys {
+			e.line(depth+1, "<key>", escape(key), "</key>")
+			if err := e.value(value[key], order.Nested(key), depth+1); err != nil {
+				return err
+			}
+		}
+		e.line(depth, "</dict>")
+	case []interface{}:
+		if len(value) == 0 {
+			e.line(depth, "<array/>")
+			return nil
+		}
+		e.line(depth, "<array>")
+		for ix, elem := range value {
+			if err := e.value(elem, order.Nested(strconv.Itoa(ix)), depth+1); err != nil {
+				return err
+			}
+		}
+		e.line(depth, "</array>")
+	case string:
+		e.line(depth, "<string>", escape(value), "</string>")
+	case bool:
+		e.line(depth, "<", strconv.FormatBool(value), "/>")
+	case int:
+		e.line(depth, "<integer>", strconv.Itoa(value), "</integer>")
+	case int64:
+		e.line(depth, "<integer>", strconv.FormatInt(value, 10), "</integer>")
+	case float64:
+		e.line(depth, "<real>", strconv.FormatFloat(value, 'f', -1, 64), "</real>")
+	case time.Time:
+		e.line(depth, "<date>", value.UTC().Format(dateFormat), "</date>")
+	case []byte:
+		e.line(depth, "<data>", base64.StdEncoding.EncodeToString(value), "</data>")
+	default:
+		return errors.Errorf("plist: unsupported type %T", value)
+	}
+	return nil
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,164 @@
+package plist
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const dateFormat = "2006-01-02T15:04:05Z"
+
+// decode reads an XML property list. Values are decoded as strings, int64, float64, bool, time.Time, []byte, maps, and arrays.
+func decode(r io.Reader, order *internal.KeyOrder) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+	start, err := nextStart(dec)
+	if err != nil {
+		return nil, err
+	}
+	if start.Name.Local != "plist" {
+		return nil, errors.Errorf("plist: expected a <plist> root element, found <%s>", start.Name.Local)
+	}
+	start, err = nextStart(dec)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(dec, start, order)
+}
+
+// nextStart returns the next start element, skipping the prolog, comments, and whitespace
+func nextStart(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, errors.Wrap(err, "plist")
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token, nil
+		case xml.EndElement:
+			return xml.StartElement{}, errors.Errorf("plist: unexpected </%s>", token.Name.Local)
+		}
+	}
+}
+
+func decodeValue(dec *xml.Decoder, start xml.StartElement, order *internal.KeyOrder) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		return decodeDict(dec, order)
+	case "array":
+		return decodeArray(dec, order)
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, errors.Wrap(err, "plist")
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	text, err := elementText(dec)
+	if err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		return i, errors.Wrapf(err, "plist: invalid integer %q", text)
+	case "real":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		return f, errors.Wrapf(err, "plist: invalid real %q", text)
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		return t, errors.Wrapf(err, "plist: invalid date %q", text)
+	case "data":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		return b, errors.Wrapf(err, "plist: invalid data %q", text)
+	default:
+		return nil, errors.Errorf("plist: unsupported element <%s>", start.Name.Local)
+	}
+}
+
+// decodeDict reads <key> elements, each followed by its value, until </dict>
+func decodeDict(dec *xml.Decoder, order *internal.KeyOrder) (interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		start, end, err := nextElement(dec)
+		if err != nil || end {
+			return m, err
+		}
+		if start.Name.Local != "key" {
+			return nil, errors.Errorf("plist: expected <key> in <dict>, found <%s>", start.Name.Local)
+		}
+		key, err := elementText(dec)
+		if err != nil {
+			return nil, err
+		}
+		start, end, err = nextElement(dec)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return nil, errors.Errorf("plist: missing value for key %q", key)
+		}
+		m[key], err = decodeValue(dec, start, order.Add(key))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeArray(dec *xml.Decoder, order *internal.KeyOrder) (interface{}, error) {
+	a := []interface{}{}
+	for {
+		start, end, err := nextElement(dec)
+		if err != nil || end {
+			return a, err
+		}
+		value, err := decodeValue(dec, start, order.Add(strconv.Itoa(len(a))))
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, value)
+	}
+}
+
+// nextElement returns the next child element, or true if the current element ended
+func nextElement(dec *xml.Decoder) (xml.StartElement, bool, error) {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, false, errors.Wrap(err, "plist")
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token, false, nil
+		case xml.EndElement:
+			return xml.StartElement{}, true, nil
+		}
+	}
+}
+
+// elementText reads the text of the current element, up to its end element
+func elementText(dec *xml.Decoder) (string, error) {
+	var text strings.Builder
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "plist")
+		}
+		switch token := token.(type) {
+		case xml.CharData:
+			text.Write(token)
+		case xml.StartElement:
+			return "", errors.Errorf("plist: unexpected <%s> in a value", token.Name.Local)
+		case xml.EndElement:
+			return text.String(), nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package plist
+
+import (
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+// tagData sets a value's type to <data>, like '!!data aGVsbG8='
+const tagData = "!!data"
+
+func init() {
+	env2config.RegisterFormat("plist", &plistMarshaler{})
+}
+
+// plistMarshaler reads and writes XML property lists.
+// Strings replacing a typed template value are converted to the template's type, like <integer> or <date>.
+// Other strings are written as <string> unless tagged with a type, like '!!int 8080' or '!!data aGVsbG8='.
+type plistMarshaler struct {
+	style env2config.Style
+}
+
+// template holds a property list template's key order and values, so their types can be preserved
+type template struct {
+	order  *internal.KeyOrder
+	values interface{}
+}
+
+func (p *plistMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	for option := range options.Format {
+		return nil, errors.Errorf("Unsupported plist format option: %q", option)
+	}
+	return &plistMarshaler{style: options.Style}, nil
+}
+
+func (p *plistMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return p.MarshalTemplate(w, value, nil)
+}
+
+func (p *plistMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	var order *internal.KeyOrder
+	var tmplValues interface{}
+	if tmpl, ok := tmpl.(*template); ok {
+		order, tmplValues = tmpl.order, tmpl.values
+	}
+	value, err := internal.TypeStrings(value, tmplValues, typeString)
+	if err != nil {
+		return err
+	}
+	enc := &encoder{indent: p.style.Indent}
+	if enc.indent == "" {
+		enc.indent = defaultIndent
+	}
+	if err := enc.encode(value, order); err != nil {
+		return err
+	}
+	return internal.WriteOutput(w, enc.buf.Bytes(), p.style.OmitTrailingNewline)
+}
+
+func (p *plistMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := p.UnmarshalTemplate(r, dest)
+	return err
+}
+
+func (*plistMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	order := internal.NewKeyOrder()
+	value, err := decode(r, order)
+	if err != nil {
+		return nil, err
+	}
+	// copy the template's values, since 'dest' is modified before it's written
+	tmplValues := internal.Walk(value, func(v interface{}) interface{} { return v })
+	return &template{order: order, values: tmplValues}, internal.SetValue(dest, value)
+}
+
+// typeString converts tagged strings, and strings replacing typed values in the template, into their types
+func typeString(s string, tmpl interface{}) (interface{}, error) {
+	if strings.HasPrefix(s, tagData+" ") {
+		return parseData(strings.TrimPrefix(s, tagData+" "))
+	}
+	if typed, tagged, err := internal.ParseTagged(s); tagged {
+		return typed, errors.Wrap(err, "plist")
+	}
+
+	var tag string
+	switch tmpl.(type) {
+	case int64:
+		tag = internal.TagInt
+	case float64:
+		tag = internal.TagFloat
+	case bool:
+		tag = internal.TagBool
+	case time.Time:
+		tag = internal.TagDatetime
+	case []byte:
+		return parseData(s)
+	default:
+		return s, nil
+	}
+	typed, err := internal.ParseAs(tag, s)
+	return typed, errors.Wrap(err, "plist")
+}
+
+func parseData(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Errorf("plist: invalid %s value %q, must be base64", tagData, s)
+	}
+	return b, nil
+}
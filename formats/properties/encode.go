@@ -0,0 +1,84 @@
+package properties
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/johnstarich/env2config/formats/internal"
+)
+
+// template holds a properties template's key order and comments, keyed by internal.PathKey() of each property's path
+type template = internal.LineTemplate
+
+func newTemplate(doc *document) *template {
+	t := internal.NewLineTemplate(doc.comments)
+	for _, prop := range doc.properties {
+		t.Add(internal.PathKey(splitKey(prop.key)), internal.TemplateLine{
+			Comments:    prop.comments,
+			BlankBefore: prop.blankBefore,
+		})
+	}
+	return t
+}
+
+// leaf is a single property to write
+type leaf struct {
+	path  []string
+	key   string
+	value interface{}
+}
+
+func encode(w io.Writer, value interface{}, arrays string, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("properties: top-level values must be maps, got %T", value)
+	}
+	leaves := flatten(nil, "", m, arrays, nil)
+	sort.SliceStable(leaves, func(a, b int) bool {
+		return t.Index(internal.PathKey(leaves[a].path)) < t.Index(internal.PathKey(leaves[b].path))
+	})
+
+	lw := t.NewWriter(w)
+	for _, l := range leaves {
+		lw.Write(internal.PathKey(l.path), escape(l.key, true)+"="+escape(internal.FormatValue(l.value), false))
+	}
+	return lw.Flush()
+}
+
+// flatten returns the scalar values nested in 'value', with map keys sorted and array elements in order
+func flatten(path []string, key string, value interface{}, arrays string, leaves []leaf) []leaf {
+	switch value := value.(type) {
+	case nil:
+		// properties have no null, so skip it
+	case map[string]interface{}:
+		if v, hasValue := value[valueKey]; hasValue {
+			leaves = flatten(path, key, v, arrays, leaves)
+		}
+		for _, k := range internal.SortedKeys(value) {
+			if k != valueKey {
+				leaves = flatten(internal.AppendKey(path, k), joinKey(key, k), value[k], arrays, leaves)
+			}
+		}
+	case []interface{}:
+		for ix, elem := range value {
+			index := strconv.Itoa(ix)
+			elemKey := key + "[" + index + "]"
+			if arrays == arraysDots {
+				elemKey = joinKey(key, index)
+			}
+			leaves = flatten(internal.AppendKey(path, index), elemKey, elem, arrays, leaves)
+		}
+	default:
+		leaves = append(leaves, leaf{path: path, key: key, value: value})
+	}
+	return leaves
+}
+
+func joinKey(key, k string) string {
+	if key == "" {
+		return k
+	}
+	return key + keySeparator + k
+}
@@ -0,0 +1,178 @@
+package properties
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// document is a parsed properties file, including its comments
+type document struct {
+	properties []property
+	comments   []string // trailing comments after the last property
+}
+
+// property is a parsed key-value pair, plus the comments above it
+type property struct {
+	key         string
+	value       string
+	comments    []string
+	blankBefore bool // separated from the previous property by a blank line
+}
+
+// parse reads a properties file in the format of Java's Properties.load()
+func parse(r io.Reader) (*document, error) {
+	scanner := bufio.NewScanner(r)
+	doc := &document{}
+	var comments []string
+	blankBefore := false
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		switch {
+		case line == "":
+			blankBefore = len(doc.properties) > 0
+			continue
+		case line[0] == '#' || line[0] == '!':
+			comments = append(comments, line)
+			continue
+		}
+		for continues(line) {
+			line = line[:len(line)-1]
+			if !scanner.Scan() {
+				break
+			}
+			line += strings.TrimLeft(scanner.Text(), " \t\f")
+		}
+		key, value, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		doc.properties = append(doc.properties, property{
+			key:         key,
+			value:       value,
+			comments:    comments,
+			blankBefore: blankBefore,
+		})
+		comments = nil
+		blankBefore = false
+	}
+	doc.comments = comments
+	return doc, scanner.Err()
+}
+
+// continues returns true if 'line' ends with an odd number of backslashes
+func continues(line string) bool {
+	backslashes := 0
+	for ix := len(line) - 1; ix >= 0 && line[ix] == '\\'; ix-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+func parseLine(line string) (key, value string, err error) {
+	keyEnd := len(line)
+	for ix := 0; ix < len(line); ix++ {
+		c := line[ix]
+		if c == '\\' {
+			ix++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			keyEnd = ix
+			break
+		}
+	}
+	key, err = unescape(line[:keyEnd])
+	if err != nil {
+		return "", "", err
+	}
+	rest := strings.TrimLeft(line[keyEnd:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	value, err = unescape(rest)
+	return key, value, err
+}
+
+func unescape(s string) (string, error) {
+	if !strings.ContainsRune(s, '\\') {
+		return s, nil
+	}
+	var result strings.Builder
+	for ix := 0; ix < len(s); ix++ {
+		c := s[ix]
+		if c != '\\' || ix+1 == len(s) {
+			result.WriteByte(c)
+			continue
+		}
+		ix++
+		switch s[ix] {
+		case 't':
+			result.WriteByte('\t')
+		case 'n':
+			result.WriteByte('\n')
+		case 'r':
+			result.WriteByte('\r')
+		case 'f':
+			result.WriteByte('\f')
+		case 'u':
+			if ix+5 > len(s) {
+				return "", errors.Errorf("Invalid unicode escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[ix+1:ix+5], 16, 16)
+			if err != nil {
+				return "", errors.Errorf("Invalid unicode escape in %q", s)
+			}
+			result.WriteRune(rune(r))
+			ix += 4
+		default:
+			result.WriteByte(s[ix])
+		}
+	}
+	return result.String(), nil
+}
+
+// escape escapes 's' like Java's Properties.store(). Keys escape all spaces, values only a leading space.
+func escape(s string, isKey bool) string {
+	var result strings.Builder
+	for ix, r := range s {
+		switch {
+		case r == '\\':
+			result.WriteString(`\\`)
+		case r == '\t':
+			result.WriteString(`\t`)
+		case r == '\n':
+			result.WriteString(`\n`)
+		case r == '\r':
+			result.WriteString(`\r`)
+		case r == '\f':
+			result.WriteString(`\f`)
+		case r == ' ' && (isKey || ix == 0):
+			result.WriteString(`\ `)
+		case strings.ContainsRune("=:#!", r):
+			result.WriteRune('\\')
+			result.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, r16 := range utf16Units(r) {
+				result.WriteString(`\u`)
+				hex := strconv.FormatUint(uint64(r16), 16)
+				result.WriteString(strings.Repeat("0", 4-len(hex)) + hex)
+			}
+		default:
+			result.WriteRune(r)
+		}
+	}
+	return result.String()
+}
+
+// utf16Units returns the UTF-16 code units of 'r', including surrogate pairs
+func utf16Units(r rune) []uint16 {
+	if r < 0x10000 {
+		return []uint16{uint16(r)}
+	}
+	r -= 0x10000
+	return []uint16{uint16(0xd800 + (r>>10)&0x3ff), uint16(0xdc00 + r&0x3ff)}
+}
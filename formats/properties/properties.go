@@ -0,0 +1,172 @@
+package properties
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	env2config.RegisterFormat("properties", &propertiesMarshaler{arrays: arraysBrackets})
+}
+
+const (
+	// arraysBrackets writes array elements with an index in brackets, like 'key[0]'
+	arraysBrackets = "brackets"
+	// arraysDots writes array elements with an index as another key, like 'key.0'
+	arraysDots = "dots"
+
+	keySeparator = "."
+	// valueKey holds the value of a property which also has nested properties, like 'a' in 'a=1' and 'a.b=2'
+	valueKey = "#value"
+)
+
+// arrayIndexes matches the trailing array indexes of a key segment, like the '[0][1]' in 'key[0][1]'
+var arrayIndexes = regexp.MustCompile(`(\[[0-9]+\])+$`)
+
+// propertiesMarshaler reads and writes Java properties files.
+// Nested keys are joined with '.' and arrays are indexed by the ARRAYS format option, either 'brackets' or 'dots'.
+type propertiesMarshaler struct {
+	arrays string
+}
+
+func (p *propertiesMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	arrays := p.arrays
+	for option, value := range options.Format {
+		switch option {
+		case "arrays":
+			if value != arraysBrackets && value != arraysDots {
+				return nil, errors.Errorf("Invalid properties arrays option %q, must be %q or %q", value, arraysBrackets, arraysDots)
+			}
+			arrays = value
+		default:
+			return nil, errors.Errorf("Unsupported properties format option: %q", option)
+		}
+	}
+	return &propertiesMarshaler{arrays: arrays}, nil
+}
+
+func (p *propertiesMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return p.MarshalTemplate(w, value, nil)
+}
+
+func (p *propertiesMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return encode(w, value, p.arrays, t)
+}
+
+func (p *propertiesMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := p.UnmarshalTemplate(r, dest)
+	return err
+}
+
+// UnmarshalTemplate decodes a properties file into nested maps, split on each '.' in the keys.
+// Array indexes like 'key[0]' become arrays, while numeric keys like 'key.0' stay map keys.
+// A property with nested properties keeps its own value in the '#value' key.
+func (p *propertiesMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := unflatten(doc)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(doc), internal.SetValue(dest, values)
+}
+
+func unflatten(doc *document) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	arrays := make(map[string]bool) // keyed by internal.PathKey() of values with bracketed indexes
+	for _, prop := range doc.properties {
+		path, isIndex := splitKeyIndexes(prop.key)
+		m := root
+		for ix, key := range path[:len(path)-1] {
+			existing, exists := m[key]
+			next, isMap := existing.(map[string]interface{})
+			if !isMap {
+				next = make(map[string]interface{})
+				if exists {
+					next[valueKey] = existing
+				}
+				m[key] = next
+			}
+			m = next
+			if isIndex[ix+1] {
+				arrays[internal.PathKey(path[:ix+1])] = true
+			}
+		}
+		lastKey := path[len(path)-1]
+		if nested, isMap := m[lastKey].(map[string]interface{}); isMap {
+			nested[valueKey] = prop.value
+			continue
+		}
+		m[lastKey] = prop.value
+	}
+	return indexesToArrays(nil, root, arrays).(map[string]interface{}), nil
+}
+
+// indexesToArrays converts maps of bracketed indexes in 'value' into arrays, in index order
+func indexesToArrays(path []string, value interface{}, arrays map[string]bool) interface{} {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return value
+	}
+	isArray := arrays[internal.PathKey(path)]
+	for key, elem := range m {
+		m[key] = indexesToArrays(internal.AppendKey(path, key), elem, arrays)
+		if _, err := strconv.Atoi(key); err != nil {
+			isArray = false // mixed with other keys, like 'a[0]' and 'a.b'
+		}
+	}
+	if !isArray {
+		return m
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		indexA, _ := strconv.Atoi(keys[a])
+		indexB, _ := strconv.Atoi(keys[b])
+		return indexA < indexB
+	})
+	values := make([]interface{}, len(keys))
+	for ix, key := range keys {
+		values[ix] = m[key]
+	}
+	return values
+}
+
+// splitKey splits a property key into its nested key path, including any array indexes
+func splitKey(key string) []string {
+	path, _ := splitKeyIndexes(key)
+	return path
+}
+
+// splitKeyIndexes is like splitKey, but also returns whether each path segment is a bracketed array index
+func splitKeyIndexes(key string) ([]string, []bool) {
+	var path []string
+	var isIndex []bool
+	for _, segment := range strings.Split(key, keySeparator) {
+		indexes := arrayIndexes.FindString(segment)
+		if indexes == "" || len(indexes) == len(segment) {
+			path = append(path, segment)
+			isIndex = append(isIndex, false)
+			continue
+		}
+		path = append(path, strings.TrimSuffix(segment, indexes))
+		isIndex = append(isIndex, false)
+		for _, index := range strings.Split(strings.Trim(indexes, "[]"), "][") {
+			path = append(path, index)
+			isIndex = append(isIndex, true)
+		}
+	}
+	return path, isIndex
+}
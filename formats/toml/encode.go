@@ -0,0 +1,223 @@
+package toml
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const indent = "  "
+
+var quotedReplacer = strings.NewReplacer(
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\"", "\\\"",
+	"\\", "\\\\",
+)
+
+// encoder writes TOML in the same style as github.com/BurntSushi/toml, but with map keys in template order
+type encoder struct {
+	w          *bufio.Writer
+	hasWritten bool
+}
+
+func encode(w io.Writer, value interface{}, order *internal.KeyOrder) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return errors.New("toml: top-level values must be maps")
+	}
+	enc := &encoder{w: bufio.NewWriter(w)}
+	if err := enc.table(nil, m, order); err != nil {
+		return err
+	}
+	return enc.w.Flush()
+}
+
+func (e *encoder) write(s ...string) {
+	for _, str := range s {
+		_, _ = e.w.WriteString(str)
+	}
+	e.hasWritten = true
+}
+
+func (e *encoder) newline() {
+	if e.hasWritten {
+		e.write("\n")
+	}
+}
+
+// table writes the key-value pairs of 'm' first, then its sub-tables
+func (e *encoder) table(key []string, m map[string]interface{}, order *internal.KeyOrder) error {
+	var directKeys, tableKeys []string
+	for _, k := range order.Keys(m) {
+		switch {
+		case m[k] == nil:
+			// TOML has no null, so skip it
+		case isTable(m[k]) || isArrayOfTables(m[k]):
+			tableKeys = append(tableKeys, k)
+		default:
+			directKeys = append(directKeys, k)
+		}
+	}
+
+	for _, k := range directKeys {
+		if err := e.keyValue(internal.AppendKey(key, k), m[k], order.Nested(k)); err != nil {
+			return err
+		}
+	}
+	for _, k := range tableKeys {
+		subKey := internal.AppendKey(key, k)
+		switch value := m[k].(type) {
+		case map[string]interface{}:
+			if len(subKey) == 1 {
+				e.newline()
+			}
+			e.write(indentFor(subKey), "[", quoteKeyPath(subKey), "]")
+			e.newline()
+			if err := e.table(subKey, value, order.Nested(k)); err != nil {
+				return err
+			}
+		case []interface{}:
+			for ix, elem := range value {
+				e.newline()
+				e.write(indentFor(subKey), "[[", quoteKeyPath(subKey), "]]")
+				e.newline()
+				if err := e.table(subKey, elem.(map[string]interface{}), order.Nested(k).Nested(strconv.Itoa(ix))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *encoder) keyValue(key []string, value interface{}, order *internal.KeyOrder) error {
+	e.write(indentFor(key), quoteKey(key[len(key)-1]), " = ")
+	if err := e.element(value, order); err != nil {
+		return err
+	}
+	e.newline()
+	return nil
+}
+
+func (e *encoder) element(value interface{}, order *internal.KeyOrder) error {
+	switch value := value.(type) {
+	case nil:
+		return errors.New("toml: cannot encode array with nil element")
+	case string:
+		e.write(`"`, quotedReplacer.Replace(value), `"`)
+	case bool:
+		e.write(strconv.FormatBool(value))
+	case int:
+		e.write(strconv.Itoa(value))
+	case int64:
+		e.write(strconv.FormatInt(value, 10))
+	case float64:
+		e.write(formatFloat(value))
+	case time.Time:
+		e.write(value.Format(time.RFC3339Nano))
+	case []interface{}:
+		e.write("[")
+		for ix, elem := range value {
+			if ix > 0 {
+				e.write(", ")
+			}
+			if err := e.element(elem, order.Nested(strconv.Itoa(ix))); err != nil {
+				return err
+			}
+		}
+		e.write("]")
+	case map[string]interface{}:
+		e.write("{")
+		for ix, k := range order.Keys(value) {
+			if ix > 0 {
+				e.write(", ")
+			}
+			e.write(quoteKey(k), " = ")
+			if err := e.element(value[k], order.Nested(k)); err != nil {
+				return err
+			}
+		}
+		e.write("}")
+	default:
+		return errors.Errorf("toml: unsupported type %T", value)
+	}
+	return nil
+}
+
+func isTable(v interface{}) bool {
+	_, isMap := v.(map[string]interface{})
+	return isMap
+}
+
+func isArrayOfTables(v interface{}) bool {
+	a, isArray := v.([]interface{})
+	if !isArray || len(a) == 0 {
+		return false
+	}
+	for _, elem := range a {
+		if !isTable(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return floatAddDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+}
+
+func floatAddDecimal(fstr string) string {
+	if !strings.Contains(fstr, ".") {
+		return fstr + ".0"
+	}
+	return fstr
+}
+
+func indentFor(key []string) string {
+	return strings.Repeat(indent, len(key)-1)
+}
+
+func quoteKeyPath(key []string) string {
+	quoted := make([]string, len(key))
+	for ix, k := range key {
+		quoted[ix] = quoteKey(k)
+	}
+	return strings.Join(quoted, ".")
+}
+
+func quoteKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !isBareKeyChar(r) {
+			return `"` + quotedReplacer.Replace(key) + `"`
+		}
+	}
+	return key
+}
+
+func isBareKeyChar(r rune) bool {
+	return (r >= 'A' && r <= 'Z') ||
+		(r >= 'a' && r <= 'z') ||
+		(r >= '0' && r <= '9') ||
+		r == '_' ||
+		r == '-'
+}
@@ -2,22 +2,113 @@ package toml
 
 import (
 	"io"
+	"strconv"
 
 	"github.com/BurntSushi/toml"
 	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
 )
 
 func init() {
-	env2config.RegisterFormat("toml", &tomlMarshaler{})
+	env2config.RegisterFormat("toml", &tomlMarshaler{inferTypes: true})
 }
 
-type tomlMarshaler struct{}
+// tomlMarshaler writes strings as native TOML types when they look like one, set with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	INFER_TYPES  'true' converts strings like '8080' or '2020-01-02T03:04:05Z' into integers, floats, booleans, and datetimes. Defaults to 'true'.
+//
+// Values tagged with a type, like '!!int 8080' or '!!str 8080', are always converted.
+type tomlMarshaler struct {
+	inferTypes bool
+}
+
+// template holds a TOML template's key order and values. Strings replacing template strings are not inferred as other types.
+type template struct {
+	order  *internal.KeyOrder
+	values map[string]interface{}
+}
+
+func (t *tomlMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newMarshaler := *t
+	for option, value := range options.Format {
+		switch option {
+		case "infer_types":
+			infer, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("Invalid toml infer types option %q, must be true or false", value)
+			}
+			newMarshaler.inferTypes = infer
+		default:
+			return nil, errors.Errorf("Unsupported toml format option: %q", option)
+		}
+	}
+	return &newMarshaler, nil
+}
 
 func (t *tomlMarshaler) Marshal(w io.Writer, value interface{}) error {
-	return toml.NewEncoder(w).Encode(value)
+	return t.MarshalTemplate(w, value, nil)
+}
+
+func (t *tomlMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	var order *internal.KeyOrder
+	var tmplValues interface{}
+	if tmpl, ok := tmpl.(*template); ok {
+		order, tmplValues = tmpl.order, tmpl.values
+	}
+	value, err := internal.TypeStrings(value, tmplValues, typeString(t.inferTypes))
+	if err != nil {
+		return err
+	}
+	return encode(w, value, order)
 }
 
-func (*tomlMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
-	_, err := toml.DecodeReader(r, dest)
+func (t *tomlMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := t.UnmarshalTemplate(r, dest)
 	return err
 }
+
+func (*tomlMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	var value map[string]interface{}
+	md, err := toml.DecodeReader(r, &value)
+	if err != nil {
+		return nil, err
+	}
+	value = internal.Walk(value, tablesToArrays).(map[string]interface{})
+	order := internal.NewKeyOrder()
+	for _, key := range md.Keys() {
+		recordOrder(value, key, order)
+	}
+	// copy the template's values, since 'dest' is modified before it's written
+	tmplValues := internal.Walk(value, func(v interface{}) interface{} { return v }).(map[string]interface{})
+	return &template{order: order, values: tmplValues}, internal.SetValue(dest, value)
+}
+
+// tablesToArrays converts arrays of tables into []interface{}, so they can be merged like any other array
+func tablesToArrays(v interface{}) interface{} {
+	tables, isTables := v.([]map[string]interface{})
+	if !isTables {
+		return v
+	}
+	values := make([]interface{}, len(tables))
+	for ix, table := range tables {
+		values[ix] = internal.Walk(table, tablesToArrays)
+	}
+	return values
+}
+
+// recordOrder adds 'key' to 'order', where 'key' is a fully-qualified key in 'v'.
+// Keys inside arrays of tables are added to every table.
+func recordOrder(v interface{}, key []string, order *internal.KeyOrder) {
+	if len(key) == 0 {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		recordOrder(v[key[0]], key[1:], order.Add(key[0]))
+	case []interface{}:
+		for ix, elem := range v {
+			recordOrder(elem, key, order.Add(strconv.Itoa(ix)))
+		}
+	}
+}
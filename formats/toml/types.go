@@ -0,0 +1,53 @@
+package toml
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+var (
+	intPattern   = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	floatPattern = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// typeString returns a function converting strings into native TOML types.
+// Tagged strings are always converted. Untagged strings are inferred if 'infer' is set, unless they replace a string in the template.
+func typeString(infer bool) func(s string, tmpl interface{}) (interface{}, error) {
+	return func(s string, tmpl interface{}) (interface{}, error) {
+		if typed, tagged, err := internal.ParseTagged(s); tagged {
+			return typed, errors.Wrap(err, "toml")
+		}
+		if _, tmplIsString := tmpl.(string); infer && !tmplIsString {
+			return inferType(s), nil
+		}
+		return s, nil
+	}
+}
+
+// inferType returns 's' as a bool, integer, float, or RFC 3339 datetime if it looks like one, otherwise returns 's'.
+// Floats are only inferred if they're written back exactly as 's', so version-like strings such as '1.10' stay strings.
+func inferType(s string) interface{} {
+	switch {
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case intPattern.MatchString(s):
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case floatPattern.MatchString(s):
+		if f, err := strconv.ParseFloat(s, 64); err == nil && formatFloat(f) == s {
+			return f
+		}
+	default:
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+package xml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const indent = "  "
+
+var (
+	textReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+	)
+	attrReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+		"\t", "&#x9;",
+	)
+)
+
+type encoder struct {
+	w        *bufio.Writer
+	template *template
+}
+
+func encode(w io.Writer, value interface{}, t *template) error {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("xml: top-level values must be maps, got %T", value)
+	}
+	var rootKeys []string
+	for key, v := range m {
+		if v != nil {
+			rootKeys = append(rootKeys, key)
+		}
+	}
+	if len(rootKeys) != 1 {
+		return errors.Errorf("xml: top-level map must have exactly 1 key for the root element, found %d", len(rootKeys))
+	}
+	root := rootKeys[0]
+
+	e := &encoder{
+		w:        bufio.NewWriter(w),
+		template: t,
+	}
+	if t == nil {
+		e.write(strings.TrimSpace(xml.Header), "\n")
+	} else {
+		for _, line := range t.prolog {
+			e.write(line, "\n")
+		}
+	}
+	if err := e.element([]string{root}, root, m[root], t.keyOrder().Nested(root), 0); err != nil {
+		return err
+	}
+	if t != nil {
+		for _, line := range t.trailing {
+			e.write(line, "\n")
+		}
+	}
+	return e.w.Flush()
+}
+
+func (e *encoder) write(s ...string) {
+	for _, str := range s {
+		_, _ = e.w.WriteString(str)
+	}
+}
+
+func (e *encoder) comments(lines []string, depth int) {
+	for _, line := range lines {
+		e.write(strings.Repeat(indent, depth), line, "\n")
+	}
+}
+
+// element writes 'value' as an element named 'name'. Arrays are written as a repeated element.
+func (e *encoder) element(path []string, name string, value interface{}, order *internal.KeyOrder, depth int) error {
+	if !isValidName(name) {
+		return errors.Errorf("xml: invalid element name %q", name)
+	}
+	switch value := value.(type) {
+	case nil:
+		// XML has no null, so skip it
+		return nil
+	case []interface{}:
+		for ix, elem := range value {
+			if _, isArray := elem.([]interface{}); isArray {
+				return errors.Errorf("xml: element %q cannot contain nested arrays", name)
+			}
+			index := strconv.Itoa(ix)
+			if err := e.element(internal.AppendKey(path, index), name, elem, order.Nested(index), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	c := e.template.comment(path)
+	e.comments(c.above, depth)
+	prefix := strings.Repeat(indent, depth)
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		text := internal.FormatValue(value)
+		if text == "" {
+			e.write(prefix, "<", name, "/>\n")
+		} else {
+			e.write(prefix, "<", name, ">", textReplacer.Replace(text), "</", name, ">\n")
+		}
+		return nil
+	}
+
+	e.write(prefix, "<", name)
+	var children []string
+	text := ""
+	for _, key := range order.Keys(m) {
+		switch {
+		case m[key] == nil:
+		case key == textKey:
+			text = internal.FormatValue(m[key])
+		case strings.HasPrefix(key, attrPrefix):
+			attr := strings.TrimPrefix(key, attrPrefix)
+			if !isValidName(attr) {
+				return errors.Errorf("xml: invalid attribute name %q", attr)
+			}
+			switch m[key].(type) {
+			case map[string]interface{}, []interface{}:
+				return errors.Errorf("xml: attribute %q must be a single value, got %T", attr, m[key])
+			}
+			e.write(" ", attr, `="`, attrReplacer.Replace(internal.FormatValue(m[key])), `"`)
+		default:
+			children = append(children, key)
+		}
+	}
+	switch {
+	case len(children) == 0 && len(c.foot) == 0 && text == "":
+		e.write("/>\n")
+		return nil
+	case len(children) == 0 && len(c.foot) == 0:
+		e.write(">", textReplacer.Replace(text), "</", name, ">\n")
+		return nil
+	}
+	e.write(">\n")
+	if text != "" {
+		e.write(prefix, indent, textReplacer.Replace(text), "\n")
+	}
+	for _, key := range children {
+		if err := e.element(internal.AppendKey(path, key), key, m[key], order.Nested(key), depth+1); err != nil {
+			return err
+		}
+	}
+	e.comments(c.foot, depth+1)
+	e.write(prefix, "</", name, ">\n")
+	return nil
+}
+
+// isValidName returns true if 'name' can be used as an element or attribute name, including an optional namespace prefix
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for ix, r := range name {
+		isNameStart := unicode.IsLetter(r) || r == '_' || r == ':'
+		if !isNameStart && (ix == 0 || !(unicode.IsDigit(r) || r == '-' || r == '.')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package xml
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrPrefix = "@"
+	textKey    = "#text"
+)
+
+// document is a parsed XML file, including its comments
+type document struct {
+	prolog   []string // XML declaration, processing instructions, and directives before the root
+	root     *node
+	comments []string // trailing comments after the root
+}
+
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	children []*node
+	text     strings.Builder
+	comments []string // comments above this element
+	foot     []string // comments after the last child
+}
+
+// parse reads an XML document. Namespace prefixes are kept as part of element and attribute names, like 'xsi:type'.
+func parse(r io.Reader) (*document, error) {
+	dec := xml.NewDecoder(r)
+	doc := &document{}
+	var stack []*node
+	var comments []string
+	for {
+		token, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			n := &node{
+				name:     qualifiedName(token.Name),
+				attrs:    token.Attr,
+				comments: comments,
+			}
+			comments = nil
+			switch {
+			case len(stack) > 0:
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			case doc.root == nil:
+				doc.root = n
+			default:
+				return nil, errors.Errorf("Multiple root elements: %q and %q", doc.root.name, n.name)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.Errorf("Unexpected end element %q", qualifiedName(token.Name))
+			}
+			stack[len(stack)-1].foot = comments
+			comments = nil
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(token)
+			}
+		case xml.Comment:
+			comments = append(comments, "<!--"+string(token)+"-->")
+		case xml.ProcInst:
+			if doc.root == nil {
+				doc.prolog = append(doc.prolog, "<?"+token.Target+" "+string(token.Inst)+"?>")
+			}
+		case xml.Directive:
+			if doc.root == nil {
+				doc.prolog = append(doc.prolog, "<!"+string(token)+">")
+			}
+		}
+	}
+	if doc.root == nil {
+		return nil, errors.New("No root element")
+	}
+	if len(stack) > 0 {
+		return nil, errors.Errorf("Unclosed element %q", stack[len(stack)-1].name)
+	}
+	doc.comments = comments
+	return doc, nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// values returns the document as a map with one key, the root element's name
+func (d *document) values() map[string]interface{} {
+	return map[string]interface{}{d.root.name: d.root.value()}
+}
+
+// value returns a string for elements with only text. Otherwise returns a map of attributes with an '@' prefix, child elements, and '#text'.
+// Repeated child elements become arrays.
+func (n *node) value() interface{} {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return text
+	}
+	m := make(map[string]interface{})
+	for _, attr := range n.attrs {
+		m[attrPrefix+qualifiedName(attr.Name)] = attr.Value
+	}
+	for name, children := range n.childrenByName() {
+		if len(children) == 1 {
+			m[name] = children[0].value()
+			continue
+		}
+		values := make([]interface{}, len(children))
+		for ix, child := range children {
+			values[ix] = child.value()
+		}
+		m[name] = values
+	}
+	if text != "" {
+		m[textKey] = text
+	}
+	return m
+}
+
+func (n *node) childrenByName() map[string][]*node {
+	children := make(map[string][]*node)
+	for _, child := range n.children {
+		children[child.name] = append(children[child.name], child)
+	}
+	return children
+}
+
+// template holds an XML template's prolog, element order, and comments, so they can be preserved in the output
+type template struct {
+	prolog   []string
+	order    *internal.KeyOrder
+	comments map[string]comment // keyed by internal.PathKey()
+	trailing []string
+}
+
+type comment struct {
+	above []string
+	foot  []string
+}
+
+func newTemplate(doc *document) *template {
+	t := &template{
+		prolog:   doc.prolog,
+		order:    internal.NewKeyOrder(),
+		comments: make(map[string]comment),
+		trailing: doc.comments,
+	}
+	t.add([]string{doc.root.name}, doc.root, t.order.Add(doc.root.name))
+	return t
+}
+
+func (t *template) add(path []string, n *node, order *internal.KeyOrder) {
+	if len(n.comments) > 0 || len(n.foot) > 0 {
+		t.comments[internal.PathKey(path)] = comment{above: n.comments, foot: n.foot}
+	}
+	for _, attr := range n.attrs {
+		order.Add(attrPrefix + qualifiedName(attr.Name))
+	}
+	if strings.TrimSpace(n.text.String()) != "" {
+		order.Add(textKey)
+	}
+	byName := n.childrenByName()
+	indexes := make(map[string]int)
+	for _, child := range n.children {
+		childPath := internal.AppendKey(path, child.name)
+		childOrder := order.Add(child.name)
+		if len(byName[child.name]) > 1 {
+			index := strconv.Itoa(indexes[child.name])
+			indexes[child.name]++
+			childPath = internal.AppendKey(childPath, index)
+			childOrder = childOrder.Add(index)
+		}
+		t.add(childPath, child, childOrder)
+	}
+}
+
+func (t *template) keyOrder() *internal.KeyOrder {
+	if t == nil {
+		return nil
+	}
+	return t.order
+}
+
+func (t *template) comment(path []string) comment {
+	if t == nil {
+		return comment{}
+	}
+	return t.comments[internal.PathKey(path)]
+}
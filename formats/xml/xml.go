@@ -0,0 +1,39 @@
+package xml
+
+import (
+	"io"
+
+	"github.com/johnstarich/env2config"
+	"github.com/johnstarich/env2config/formats/internal"
+)
+
+func init() {
+	env2config.RegisterFormat("xml", &xmlMarshaler{})
+}
+
+// xmlMarshaler reads and writes XML documents as nested maps.
+// The top-level map has one key, the root element. Keys starting with '@' are attributes,
+// '#text' is an element's text alongside attributes or child elements, and arrays are repeated elements.
+type xmlMarshaler struct{}
+
+func (x *xmlMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return x.MarshalTemplate(w, value, nil)
+}
+
+func (x *xmlMarshaler) MarshalTemplate(w io.Writer, value interface{}, tmpl interface{}) error {
+	t, _ := tmpl.(*template)
+	return encode(w, value, t)
+}
+
+func (x *xmlMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := x.UnmarshalTemplate(r, dest)
+	return err
+}
+
+func (x *xmlMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(doc), internal.SetValue(dest, doc.values())
+}
@@ -0,0 +1,290 @@
+package yaml
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/johnstarich/env2config/formats/internal"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	mergeTag = "!!merge"
+	intTag   = "!!int"
+)
+
+// templateMerger builds a document from a template document and the final values.
+// Unchanged template nodes are reused as-is, which preserves their comments, anchors, aliases, and styles.
+// Changed nodes keep the comments, anchor, and style of the template node they replace.
+type templateMerger struct {
+	// changedAnchors are anchored template nodes whose contents changed, so aliases to them must be expanded
+	changedAnchors map[*yaml.Node]bool
+	// style is the style of new nodes
+	style nodeStyle
+}
+
+func newTemplateMerger(style nodeStyle) *templateMerger {
+	return &templateMerger{
+		changedAnchors: make(map[*yaml.Node]bool),
+		style:          style,
+	}
+}
+
+func (m *templateMerger) mergeDocument(value interface{}, doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return m.style.newNode(value)
+	}
+	root, err := m.merge(value, doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	newDoc := *doc
+	newDoc.Content = []*yaml.Node{root}
+	return &newDoc, nil
+}
+
+func (m *templateMerger) merge(value interface{}, tmpl *yaml.Node) (*yaml.Node, error) {
+	if tmpl == nil {
+		return m.style.newNode(value)
+	}
+	if m.unchanged(value, tmpl) {
+		return tmpl, nil
+	}
+	if tmpl.Kind == yaml.AliasNode {
+		// the alias no longer matches, so expand it into a copy of its target
+		node, err := m.merge(value, tmpl.Alias)
+		if err != nil {
+			return nil, err
+		}
+		node = copyWithoutAnchors(node)
+		copyComments(node, tmpl)
+		return node, nil
+	}
+
+	var node *yaml.Node
+	var err error
+	switch value := value.(type) {
+	case map[string]interface{}:
+		node, err = m.mergeMapping(value, tmpl)
+	case []interface{}:
+		node, err = m.mergeSequence(value, tmpl)
+	default:
+		node, err = m.mergeScalar(value, tmpl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	copyComments(node, tmpl)
+	if tmpl.Anchor != "" {
+		node.Anchor = tmpl.Anchor
+		m.changedAnchors[tmpl] = true
+	}
+	return node, nil
+}
+
+// unchanged returns true if 'tmpl' still represents 'value'
+func (m *templateMerger) unchanged(value interface{}, tmpl *yaml.Node) bool {
+	if m.aliasesChangedAnchor(tmpl) {
+		return false
+	}
+	tmplValue, err := decodeNode(tmpl)
+	return err == nil && reflect.DeepEqual(value, tmplValue)
+}
+
+func (m *templateMerger) aliasesChangedAnchor(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		return m.changedAnchors[node.Alias] || m.aliasesChangedAnchor(node.Alias)
+	}
+	for _, child := range node.Content {
+		if m.aliasesChangedAnchor(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *templateMerger) mergeMapping(value map[string]interface{}, tmpl *yaml.Node) (*yaml.Node, error) {
+	if tmpl.Kind != yaml.MappingNode {
+		return m.style.newNode(value)
+	}
+	node := &yaml.Node{
+		Kind:  yaml.MappingNode,
+		Style: tmpl.Style,
+		Tag:   tmpl.Tag,
+	}
+	inherited, keepMerges := m.mergedKeys(value, tmpl)
+	done := make(map[string]bool)
+	for ix := 0; ix+1 < len(tmpl.Content); ix += 2 {
+		keyNode, valueNode := tmpl.Content[ix], tmpl.Content[ix+1]
+		if isMergeKey(keyNode) {
+			if keepMerges {
+				node.Content = append(node.Content, keyNode, valueNode)
+			}
+			continue
+		}
+		key := keyNode.Value
+		v, exists := value[key]
+		if !exists || done[key] {
+			continue
+		}
+		done[key] = true
+		newValueNode, err := m.merge(v, valueNode)
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, keyNode, newValueNode)
+	}
+	if keepMerges {
+		for key, inheritedValue := range inherited {
+			if !done[key] && reflect.DeepEqual(value[key], inheritedValue) {
+				done[key] = true
+			}
+		}
+	}
+
+	templateLen := len(node.Content)
+	intKeys := hasIntKeys(tmpl)
+	for _, key := range internal.SortedKeys(value) {
+		if done[key] {
+			continue
+		}
+		keyNode, err := encodeNode(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, parseErr := strconv.ParseInt(key, 10, 64); intKeys && parseErr == nil {
+			// keys are decoded as strings, so restore the template's integer key type, like HTTP status codes
+			keyNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: intTag, Value: key}
+		}
+		valueNode, err := m.style.newNode(value[key])
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, keyNode, valueNode)
+	}
+	if templateLen > 0 && templateLen < len(node.Content) {
+		// keep the template's last foot comment at the end, after any new keys
+		lastTemplateKey := *node.Content[templateLen-2]
+		node.Content[len(node.Content)-2].FootComment = lastTemplateKey.FootComment
+		lastTemplateKey.FootComment = ""
+		node.Content[templateLen-2] = &lastTemplateKey
+	}
+	return node, nil
+}
+
+// mergedKeys returns the keys 'tmpl' inherits from merge keys, like '<<: *defaults', and whether the merge keys still apply to 'value'
+func (m *templateMerger) mergedKeys(value map[string]interface{}, tmpl *yaml.Node) (map[string]interface{}, bool) {
+	inherited := make(map[string]interface{})
+	for ix := 0; ix+1 < len(tmpl.Content); ix += 2 {
+		if !isMergeKey(tmpl.Content[ix]) {
+			continue
+		}
+		sources := []*yaml.Node{tmpl.Content[ix+1]}
+		if sources[0].Kind == yaml.SequenceNode {
+			sources = sources[0].Content
+		}
+		for _, source := range sources {
+			if m.aliasesChangedAnchor(source) {
+				return nil, false
+			}
+			decoded, err := decodeNode(source)
+			sourceValue, isMap := decoded.(map[string]interface{})
+			if err != nil || !isMap {
+				return nil, false
+			}
+			for key, v := range sourceValue {
+				if _, exists := inherited[key]; !exists {
+					inherited[key] = v
+				}
+			}
+		}
+	}
+	for key := range inherited {
+		if _, exists := value[key]; !exists {
+			return nil, false // merge keys can't remove an inherited key
+		}
+	}
+	return inherited, true
+}
+
+func (m *templateMerger) mergeSequence(value []interface{}, tmpl *yaml.Node) (*yaml.Node, error) {
+	if tmpl.Kind != yaml.SequenceNode {
+		return m.style.newNode(value)
+	}
+	node := &yaml.Node{
+		Kind:  yaml.SequenceNode,
+		Style: tmpl.Style,
+		Tag:   tmpl.Tag,
+	}
+	for ix, v := range value {
+		var elemTmpl *yaml.Node
+		if ix < len(tmpl.Content) {
+			elemTmpl = tmpl.Content[ix]
+		}
+		elem, err := m.merge(v, elemTmpl)
+		if err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, elem)
+	}
+	return node, nil
+}
+
+// mergeScalar returns a new node for 'value'. Strings replacing quoted or block strings keep the same style, and stay strings.
+func (m *templateMerger) mergeScalar(value interface{}, tmpl *yaml.Node) (*yaml.Node, error) {
+	str, isString := value.(string)
+	if isString && tmpl.Kind == yaml.ScalarNode && tmpl.ShortTag() == "!!str" {
+		switch tmpl.Style {
+		case yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle, yaml.LiteralStyle, yaml.FoldedStyle:
+			return &yaml.Node{
+				Kind:  yaml.ScalarNode,
+				Style: tmpl.Style,
+				Tag:   tmpl.Tag,
+				Value: str,
+			}, nil
+		}
+	}
+	return m.style.newNode(value)
+}
+
+// hasIntKeys returns true if all of the keys in mapping node 'tmpl' are integers
+func hasIntKeys(tmpl *yaml.Node) bool {
+	found := false
+	for ix := 0; ix+1 < len(tmpl.Content); ix += 2 {
+		keyNode := tmpl.Content[ix]
+		if isMergeKey(keyNode) {
+			continue
+		}
+		if keyNode.Kind != yaml.ScalarNode || keyNode.ShortTag() != intTag {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func isMergeKey(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Value == "<<" && (node.Tag == "" || node.ShortTag() == mergeTag)
+}
+
+func copyComments(dest, src *yaml.Node) {
+	if dest.HeadComment == "" {
+		dest.HeadComment = src.HeadComment
+	}
+	if dest.LineComment == "" {
+		dest.LineComment = src.LineComment
+	}
+	if dest.FootComment == "" {
+		dest.FootComment = src.FootComment
+	}
+}
+
+func copyWithoutAnchors(node *yaml.Node) *yaml.Node {
+	newNode := *node
+	newNode.Anchor = ""
+	newNode.Content = make([]*yaml.Node, len(node.Content))
+	for ix, child := range node.Content {
+		newNode.Content[ix] = copyWithoutAnchors(child)
+	}
+	return &newNode
+}
@@ -1,30 +1,329 @@
 package yaml
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"reflect"
 	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/johnstarich/env2config"
 	"github.com/johnstarich/env2config/formats/internal"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 func init() {
 	env2config.RegisterFormat("yaml", &yamlMarshaler{})
+	env2config.RegisterAlias("yml", "yaml")
 }
 
-type yamlMarshaler struct{}
+// yamlMarshaler reads and writes YAML.
+//
+// Format options, set with <name>_OPTS_FORMAT_<option> env vars:
+//
+//	MULTI_DOCUMENT  'true' writes a stream of documents, one per element of the top-level array. Defaults to 'true' for templates with multiple documents.
+type yamlMarshaler struct {
+	multiDocument bool
+	style         env2config.Style
+}
+
+// documents is the template for a stream of YAML documents
+type documents struct {
+	nodes  []*yaml.Node
+	values []interface{} // the decoded value of each node
+}
+
+var _ env2config.ArrayTemplate = &documents{}
+
+// IsArray returns true, since each document is an element of the top-level array
+func (d *documents) IsArray() bool { return true }
+
+func (y *yamlMarshaler) WithOptions(options env2config.MarshalOptions) (env2config.Marshaler, error) {
+	newMarshaler := *y
+	if strings.Trim(options.Style.Indent, " ") != "" {
+		return nil, errors.New("yaml: indent must be spaces")
+	}
+	newMarshaler.style = options.Style
+	for option, value := range options.Format {
+		switch option {
+		case "multi_document":
+			multiDocument, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("Invalid yaml multi_document option %q, must be true or false", value)
+			}
+			newMarshaler.multiDocument = multiDocument
+		default:
+			return nil, errors.Errorf("Unsupported yaml format option: %q", option)
+		}
+	}
+	return &newMarshaler, nil
+}
+
+func (y *yamlMarshaler) Marshal(w io.Writer, value interface{}) error {
+	return y.MarshalTemplate(w, value, nil)
+}
+
+func (y *yamlMarshaler) MarshalTemplate(w io.Writer, value interface{}, template interface{}) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	if y.style.Indent != "" {
+		enc.SetIndent(len(y.style.Indent))
+	}
+	docs, isMultiDocument := template.(*documents)
+	if isMultiDocument || y.multiDocument {
+		if err := y.marshalDocuments(enc, value, docs); err != nil {
+			return err
+		}
+		return internal.WriteOutput(w, buf.Bytes(), y.style.OmitTrailingNewline)
+	}
+
+	var node *yaml.Node
+	var err error
+	if doc, isNode := template.(*yaml.Node); isNode {
+		node, err = newTemplateMerger(y.nodeStyle()).mergeDocument(value, doc)
+	} else {
+		node, err = y.nodeStyle().newNode(value)
+	}
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return internal.WriteOutput(w, buf.Bytes(), y.style.OmitTrailingNewline)
+}
+
+// marshalDocuments writes each element of 'value' as a separate document, merged with its template document
+func (y *yamlMarshaler) marshalDocuments(enc *yaml.Encoder, value interface{}, docs *documents) error {
+	var values []interface{}
+	switch value := value.(type) {
+	case []interface{}:
+		values = value
+	case map[string]interface{}:
+		if len(value) != 0 {
+			return errors.Errorf("yaml: multiple documents must be an array, got a map. Prefix keys with a document index, like '0.key'")
+		}
+	default:
+		return errors.Errorf("yaml: multiple documents must be an array, got %T", value)
+	}
+
+	for ix, docValue := range values {
+		var node *yaml.Node
+		var err error
+		if doc := docs.find(ix, docValue); doc != nil {
+			node, err = newTemplateMerger(y.nodeStyle()).mergeDocument(docValue, doc)
+		} else {
+			node, err = y.nodeStyle().newNode(docValue)
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(node); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
 
-func (*yamlMarshaler) Marshal(w io.Writer, value interface{}) error {
-	value = internal.Walk(value, parseValues)
-	value = internal.Walk(value, omitNils)
-	return yaml.NewEncoder(w).Encode(value)
+func (y *yamlMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
+	_, err := y.UnmarshalTemplate(r, dest)
+	return err
 }
 
-func (*yamlMarshaler) Unmarshal(r io.Reader, dest interface{}) error {
-	return yaml.NewDecoder(r).Decode(dest)
+// find returns the template document for 'value', the document at 'index' in the output.
+// Indexes shift when template documents are deleted, so documents decoded as maps are found by identity instead, since they're updated in place.
+func (d *documents) find(index int, value interface{}) *yaml.Node {
+	if d == nil {
+		return nil
+	}
+	if _, isMap := value.(map[string]interface{}); isMap {
+		for ix, docValue := range d.values {
+			if _, isDocMap := docValue.(map[string]interface{}); isDocMap && reflect.ValueOf(docValue).Pointer() == reflect.ValueOf(value).Pointer() {
+				return d.nodes[ix]
+			}
+		}
+		return nil
+	}
+	if index < len(d.nodes) {
+		if _, isDocMap := d.values[index].(map[string]interface{}); !isDocMap {
+			return d.nodes[index]
+		}
+	}
+	return nil
+}
+
+// UnmarshalTemplate decodes 'r' into 'dest' and returns the parsed document, so comments and styles can be preserved.
+// Streams of multiple documents decode into a map of document indexes, like {"0": {...}, "1": {...}}.
+func (y *yamlMarshaler) UnmarshalTemplate(r io.Reader, dest interface{}) (interface{}, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(r)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF && len(docs) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		untagMergeKeys(&doc)
+		docs = append(docs, &doc)
+	}
+
+	if len(docs) == 1 && !y.multiDocument {
+		value, err := decodeNode(docs[0])
+		if err != nil {
+			return nil, err
+		}
+		return docs[0], internal.SetValue(dest, value)
+	}
+	template := &documents{nodes: docs}
+	values := make(map[string]interface{}, len(docs))
+	for ix, doc := range docs {
+		value, err := decodeNode(doc)
+		if err != nil {
+			return nil, err
+		}
+		template.values = append(template.values, value)
+		values[strconv.Itoa(ix)] = value
+	}
+	return template, internal.SetValue(dest, values)
+}
+
+// untagMergeKeys removes explicit tags from merge keys. Otherwise they're encoded as '!!merge <<'.
+func untagMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for ix := 0; ix < len(node.Content); ix += 2 {
+			if key := node.Content[ix]; isMergeKey(key) {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, child := range node.Content {
+		untagMergeKeys(child)
+	}
+}
+
+// decodeNode decodes 'node' into generic values. Maps always use string keys, including maps with merge keys like '<<: *defaults'.
+// Integer keys, like HTTP status codes, are restored from the template when merging.
+func decodeNode(node *yaml.Node) (interface{}, error) {
+	var value interface{}
+	err := node.Decode(&value)
+	return stringKeys(value), err
+}
+
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = stringKeys(value)
+		}
+		return v
+	case []interface{}:
+		for ix, value := range v {
+			v[ix] = stringKeys(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// nodeStyle sets the style of new nodes. Zero values use yaml.v3's default styles.
+type nodeStyle struct {
+	sequence yaml.Style
+	quote    yaml.Style
+}
+
+func (y *yamlMarshaler) nodeStyle() nodeStyle {
+	var s nodeStyle
+	if y.style.SequenceStyle == env2config.SequenceFlow {
+		s.sequence = yaml.FlowStyle
+	}
+	switch y.style.QuoteStyle {
+	case env2config.QuoteSingle:
+		s.quote = yaml.SingleQuotedStyle
+	case env2config.QuoteDouble:
+		s.quote = yaml.DoubleQuotedStyle
+	}
+	return s
+}
+
+// newNode encodes 'v' as a yaml.Node with sorted map keys
+func (s nodeStyle) newNode(v interface{}) (*yaml.Node, error) {
+	v = internal.Walk(v, parseValues)
+	v = internal.Walk(v, omitNils)
+	node, err := encodeNode(v)
+	if err != nil {
+		return nil, err
+	}
+	s.apply(node)
+	return node, nil
+}
+
+// apply sets the style of 'node' and its children. Map keys and multi-line strings keep their style.
+func (s nodeStyle) apply(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		if s.sequence != 0 {
+			node.Style = s.sequence
+		}
+		for _, child := range node.Content {
+			s.apply(child)
+		}
+	case yaml.MappingNode:
+		for ix := 1; ix < len(node.Content); ix += 2 {
+			s.apply(node.Content[ix])
+		}
+	case yaml.ScalarNode:
+		if s.quote != 0 && node.ShortTag() == "!!str" && node.Style != yaml.LiteralStyle {
+			node.Style = s.quote
+		}
+	}
+}
+
+func encodeNode(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case *yaml.Node:
+		return v, nil
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range internal.SortedKeys(v) {
+			keyNode, err := encodeNode(key)
+			if err != nil {
+				return nil, err
+			}
+			valueNode, err := encodeNode(v[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, valueNode)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, value := range v {
+			valueNode, err := encodeNode(value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, valueNode)
+		}
+		return node, nil
+	default:
+		var node yaml.Node
+		err := node.Encode(v)
+		return &node, err
+	}
 }
 
 func omitNils(v interface{}) interface{} {
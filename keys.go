@@ -4,35 +4,230 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
 )
 
 const (
 	keySeparator    = '.'
 	keySeparatorStr = string(keySeparator)
+
+	anyKey           = "*"  // matches any one key path segment
+	anyKeyPath       = "**" // matches zero or more key path segments
+	negateKeyPattern = '!'  // excludes matching keys from a set of patterns
 )
 
-// parseKeyPath splits 'key' by '.' and returns the paths. Skips over escapes like '\.'.
-func parseKeyPath(key string) []string {
-	cursor := 0
+// parseKeyPath splits 'key' into its path segments. Segments are separated by '.' and may be written a few ways:
+//
+//	plain:    a.b.c
+//	escaped:  a\.b.c        => ["a.b", "c"]
+//	quoted:   a.'b.c'.d     => ["a", "b.c", "d"]
+//	          a."b\"c".d    => ["a", `b"c`, "d"]
+//	brackets: a["b.c"].d[0] => ["a", "b.c", "d", "0"]
+//
+// Single-quoted segments are literal. Double-quoted segments use '\' to escape the next character.
+// Bracketed segments contain either a quoted segment or any characters besides ']'.
+func parseKeyPath(key string) ([]string, error) {
+	segments, err := parseKeySegments(key)
+	if err != nil {
+		return nil, err
+	}
 	var paths []string
-	for ix, r := range key {
-		if r == keySeparator && (ix == 0 || key[ix-1] != '\\') {
-			paths = append(paths, unescapeKey(key[cursor:ix]))
-			cursor = ix + 1
+	for _, segment := range segments {
+		paths = append(paths, segment.key)
+	}
+	return paths, nil
+}
+
+// keySegment is a single parsed key path segment
+type keySegment struct {
+	key string
+	// literal is true if the segment was quoted or escaped, and therefore can't be a wildcard
+	literal bool
+}
+
+func parseKeySegments(key string) ([]keySegment, error) {
+	p := keyPathParser{key: key}
+	segments, err := p.parse()
+	return segments, errors.Wrapf(err, "Invalid key %q", key)
+}
+
+type keyPathParser struct {
+	key    string
+	cursor int
+}
+
+func (p *keyPathParser) parse() ([]keySegment, error) {
+	if p.key == "" {
+		return nil, nil
+	}
+	var paths []keySegment
+	for {
+		var segment keySegment
+		var err error
+		if p.peek() == '[' {
+			segment, err = p.parseBracket()
+		} else {
+			segment, err = p.parseSegment()
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, segment)
+
+		switch p.peek() {
+		case 0:
+			return paths, nil
+		case keySeparator:
+			p.cursor++
+			if p.peek() == '[' {
+				return nil, p.errorf("unexpected '['")
+			}
+		case '[':
+		default:
+			return nil, p.errorf("expected '.' or '['")
 		}
 	}
-	if cursor < len(key) {
-		paths = append(paths, unescapeKey(key[cursor:]))
+}
+
+// peek returns the next byte, or 0 if there are no more
+func (p *keyPathParser) peek() byte {
+	if p.cursor >= len(p.key) {
+		return 0
 	}
-	return paths
+	return p.key[p.cursor]
 }
 
-func unescapeKey(key string) string {
-	return strings.Replace(key, `\.`, keySeparatorStr, -1)
+func (p *keyPathParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("column %d: "+format, append([]interface{}{p.cursor + 1}, args...)...)
 }
 
+func (p *keyPathParser) parseSegment() (keySegment, error) {
+	switch p.peek() {
+	case '\'', '"':
+		return p.parseQuoted()
+	}
+	var segment strings.Builder
+	escaped := false
+	for {
+		switch c := p.peek(); c {
+		case 0, keySeparator, '[':
+			if segment.Len() == 0 {
+				return keySegment{}, p.errorf("empty key segment")
+			}
+			return keySegment{key: segment.String(), literal: escaped}, nil
+		case '\\':
+			p.cursor++
+			switch next := p.peek(); next {
+			case keySeparator, '[':
+				segment.WriteByte(next)
+				escaped = true
+				p.cursor++
+			default:
+				segment.WriteByte(c)
+			}
+		default:
+			segment.WriteByte(c)
+			p.cursor++
+		}
+	}
+}
+
+func (p *keyPathParser) parseQuoted() (keySegment, error) {
+	start := p.cursor
+	quote := p.peek()
+	p.cursor++
+	var segment strings.Builder
+	for {
+		c := p.peek()
+		switch {
+		case c == 0:
+			p.cursor = start
+			return keySegment{}, p.errorf("unterminated quote")
+		case c == quote:
+			p.cursor++
+			return keySegment{key: segment.String(), literal: true}, nil
+		case c == '\\' && quote == '"':
+			p.cursor++
+			if p.peek() == 0 {
+				p.cursor = start
+				return keySegment{}, p.errorf("unterminated quote")
+			}
+			segment.WriteByte(p.peek())
+			p.cursor++
+		default:
+			segment.WriteByte(c)
+			p.cursor++
+		}
+	}
+}
+
+func (p *keyPathParser) parseBracket() (keySegment, error) {
+	start := p.cursor
+	p.cursor++ // skip '['
+	var segment keySegment
+	switch p.peek() {
+	case '\'', '"':
+		var err error
+		segment, err = p.parseQuoted()
+		if err != nil {
+			return keySegment{}, err
+		}
+	default:
+		end := strings.IndexByte(p.key[p.cursor:], ']')
+		if end == -1 {
+			p.cursor = start
+			return keySegment{}, p.errorf("unterminated '['")
+		}
+		segment.key = p.key[p.cursor : p.cursor+end]
+		p.cursor += end
+		if segment.key == "" {
+			return keySegment{}, p.errorf("empty key segment")
+		}
+	}
+	if p.peek() != ']' {
+		return keySegment{}, p.errorf("expected ']'")
+	}
+	p.cursor++
+	return segment, nil
+}
+
+// escapeKey returns 'key' in a form parseKeyPath will read back as a single segment.
+// Keys with special characters are quoted, all others are returned as-is.
 func escapeKey(key string) string {
-	return strings.Replace(key, keySeparatorStr, `\.`, -1)
+	if !needsQuotes(key) {
+		return key
+	}
+	if !strings.ContainsRune(key, '\'') {
+		return "'" + key + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(key) + `"`
+}
+
+func needsQuotes(key string) bool {
+	switch {
+	case key == "", key == anyKey, key == anyKeyPath, key[0] == negateKeyPattern:
+		return true
+	}
+	return strings.IndexFunc(key, func(r rune) bool {
+		switch r {
+		case keySeparator, '[', ']', '\'', '"', '\\':
+			return true
+		default:
+			return unicode.IsSpace(r)
+		}
+	}) != -1
+}
+
+// formatKeyPath joins 'keys' into a single key. The result is parsed back into 'keys' by parseKeyPath.
+func formatKeyPath(keys []string) string {
+	escapedKeys := make([]string, len(keys))
+	for ix, key := range keys {
+		escapedKeys[ix] = escapeKey(key)
+	}
+	return strings.Join(escapedKeys, keySeparatorStr)
 }
 
 func deleteKeyPath(v interface{}, keyPath []string) (newValue interface{}, deleteMe bool) {
@@ -43,6 +238,9 @@ func deleteKeyPath(v interface{}, keyPath []string) (newValue interface{}, delet
 	nextKeyPath := keyPath[1:]
 	switch v := v.(type) {
 	case map[string]interface{}:
+		if _, exists := v[key]; !exists {
+			return v, false
+		}
 		newVal, shouldDelete := deleteKeyPath(v[key], nextKeyPath)
 		v[key] = newVal
 		if shouldDelete {
@@ -65,13 +263,198 @@ func deleteKeyPath(v interface{}, keyPath []string) (newValue interface{}, delet
 	}
 }
 
+// expandKeyPatterns returns all key paths in 'v' matching any of 'patterns', formatted by formatKeyPath.
+//
+// Unquoted segments of '*' match any single key and '**' matches zero or more keys, e.g. 'servers.*.debug' or '**.debug'.
+// Patterns starting with '!' exclude any matching keys and their children from the results, regardless of pattern order.
+// If an excluded key is nested in a matched key, the matched key is replaced by its siblings of the excluded key instead.
+func expandKeyPatterns(v interface{}, patterns []string) ([]string, error) {
+	var includes, excludes [][]keySegment
+	for _, pattern := range patterns {
+		negate := pattern != "" && pattern[0] == negateKeyPattern
+		if negate {
+			pattern = pattern[1:]
+		}
+		segments, err := parseKeySegments(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			excludes = append(excludes, segments)
+		} else {
+			includes = append(includes, segments)
+		}
+	}
+
+	excludeKeys := make(map[string]bool)
+	for _, pattern := range excludes {
+		matchKeyPattern(v, pattern, nil, func(keyPath []string) {
+			excludeKeys[formatKeyPath(keyPath)] = true
+		})
+	}
+
+	matched := make(map[string]bool)
+	var matches []string
+	var addMatch func(v interface{}, keyPath []string)
+	addMatch = func(v interface{}, keyPath []string) {
+		for i := range keyPath {
+			if excludeKeys[formatKeyPath(keyPath[:i+1])] {
+				return // key or a parent of key is excluded
+			}
+		}
+		key := formatKeyPath(keyPath)
+		if matched[key] {
+			return
+		}
+		for excludeKey := range excludeKeys {
+			if strings.HasPrefix(excludeKey, key+keySeparatorStr) {
+				// an excluded key is nested inside this one, so match its siblings instead
+				keys, values := keyChildren(v)
+				for ix := range keys {
+					addMatch(values[ix], appendKey(keyPath, keys[ix]))
+				}
+				return
+			}
+		}
+		matched[key] = true
+		matches = append(matches, key)
+	}
+	for _, pattern := range includes {
+		matchKeyPattern(v, pattern, nil, func(keyPath []string) {
+			value, _ := lookupKeyPath(v, keyPath)
+			addMatch(value, keyPath)
+		})
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchKeyPattern calls 'match' for every non-empty key path in 'v' matching 'pattern'
+func matchKeyPattern(v interface{}, pattern []keySegment, keyPath []string, match func(keyPath []string)) {
+	if len(pattern) == 0 {
+		if len(keyPath) > 0 {
+			match(keyPath)
+		}
+		return
+	}
+	segment := pattern[0]
+	keys, values := keyChildren(v)
+	switch {
+	case !segment.literal && segment.key == anyKeyPath:
+		matchKeyPattern(v, pattern[1:], keyPath, match)
+		for ix := range keys {
+			matchKeyPattern(values[ix], pattern, appendKey(keyPath, keys[ix]), match)
+		}
+	case !segment.literal && segment.key == anyKey:
+		for ix := range keys {
+			matchKeyPattern(values[ix], pattern[1:], appendKey(keyPath, keys[ix]), match)
+		}
+	default:
+		for ix := range keys {
+			if keys[ix] == segment.key {
+				matchKeyPattern(values[ix], pattern[1:], appendKey(keyPath, keys[ix]), match)
+			}
+		}
+	}
+}
+
+// keyPaths returns every key path in 'v', formatted by formatKeyPath
+func keyPaths(v interface{}) map[string]bool {
+	keys := make(map[string]bool)
+	matchKeyPattern(v, []keySegment{{key: anyKeyPath}}, nil, func(keyPath []string) {
+		keys[formatKeyPath(keyPath)] = true
+	})
+	return keys
+}
+
+// appendKey returns a copy of 'keyPath' with 'key' appended
+func appendKey(keyPath []string, key string) []string {
+	return append(keyPath[:len(keyPath):len(keyPath)], key)
+}
+
+// keyChildren returns the keys and values nested directly inside 'v'. Map keys are sorted.
+func keyChildren(v interface{}) ([]string, []interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		for ix, key := range keys {
+			values[ix] = v[key]
+		}
+		return keys, values
+	case []interface{}:
+		keys := make([]string, len(v))
+		for ix := range v {
+			keys[ix] = strconv.Itoa(ix)
+		}
+		return keys, v
+	default:
+		return nil, nil
+	}
+}
+
+// lookupKeyPath returns the value at 'keyPath' inside 'v'
+func lookupKeyPath(v interface{}, keyPath []string) (interface{}, bool) {
+	for _, key := range keyPath {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			var exists bool
+			v, exists = value[key]
+			if !exists {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.ParseUint(key, 10, 64)
+			if err != nil || index >= uint64(len(value)) {
+				return nil, false
+			}
+			v = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
 // sortTemplateDeleteKeys sorts keys so that they can all be honored correctly.
 // Edge cases come into play when deleting array elements, since the indexes change.
-func sortTemplateDeleteKeys(deleteKeys []string) {
+// Returns an error if any keys are invalid.
+// sortValueKeys sorts keys into the order their values are set: parents before the keys nested inside them, then by key path.
+// Nested keys take precedence over their parents, since setting a nested key replaces its parent's value with a map.
+func sortValueKeys(keys []string) error {
+	keyPaths := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		keyPath, err := parseKeyPath(key)
+		if err != nil {
+			return err
+		}
+		keyPaths[key] = keyPath
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		pathA, pathB := keyPaths[keys[a]], keyPaths[keys[b]]
+		if len(pathA) != len(pathB) {
+			return len(pathA) < len(pathB)
+		}
+		if formatA, formatB := formatKeyPath(pathA), formatKeyPath(pathB); formatA != formatB {
+			return formatA < formatB
+		}
+		return keys[a] < keys[b] // same key path written differently, like 'a.b' and 'a[b]'
+	})
+	return nil
+}
+
+func sortTemplateDeleteKeys(deleteKeys []string) error {
 	keyPaths := make(map[string][]string)
 	possibleIndexes := make(map[string]uint64)
 	for _, deleteKey := range deleteKeys {
-		keys := parseKeyPath(deleteKey)
+		keys, err := parseKeyPath(deleteKey)
+		if err != nil {
+			return err
+		}
 		keyPaths[deleteKey] = keys
 		keyStr := ""
 		for _, key := range keys {
@@ -99,4 +482,5 @@ func sortTemplateDeleteKeys(deleteKeys []string) {
 		}
 		return false // (3) if no key path segments differed, no need to sort further
 	})
+	return nil
 }
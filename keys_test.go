@@ -4,12 +4,14 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseKeyPath(t *testing.T) {
 	for _, tc := range []struct {
-		input  string
-		expect []string
+		input     string
+		expect    []string
+		expectErr string
 	}{
 		{
 			input:  `x`,
@@ -23,9 +25,127 @@ func TestParseKeyPath(t *testing.T) {
 			input:  `x\.y.z`,
 			expect: []string{`x.y`, `z`},
 		},
+		{
+			input:  `x\y.z`,
+			expect: []string{`x\y`, `z`},
+		},
+		{
+			input:  `x.'y.z'.a`,
+			expect: []string{`x`, `y.z`, `a`},
+		},
+		{
+			input:  `x."y\".z\\"`,
+			expect: []string{`x`, `y".z\`},
+		},
+		{
+			input:  `it's.x`,
+			expect: []string{`it's`, `x`},
+		},
+		{
+			input:  `'x y'`,
+			expect: []string{`x y`},
+		},
+		{
+			input:  `''.x`,
+			expect: []string{``, `x`},
+		},
+		{
+			input:  `x["y.z"].a`,
+			expect: []string{`x`, `y.z`, `a`},
+		},
+		{
+			input:  `x[0][1].y`,
+			expect: []string{`x`, `0`, `1`, `y`},
+		},
+		{
+			input:  `["x"]['y']`,
+			expect: []string{`x`, `y`},
+		},
+		{
+			input:  `x[y z]`,
+			expect: []string{`x`, `y z`},
+		},
+		{
+			input:  `a[b.c]`,
+			expect: []string{`a`, `b.c`},
+		},
+		{
+			input:     `x..y`,
+			expectErr: `Invalid key "x..y": column 3: empty key segment`,
+		},
+		{
+			input:     `x.`,
+			expectErr: `Invalid key "x.": column 3: empty key segment`,
+		},
+		{
+			input:     `x.'y`,
+			expectErr: `Invalid key "x.'y": column 3: unterminated quote`,
+		},
+		{
+			input:     `'x'y`,
+			expectErr: `Invalid key "'x'y": column 4: expected '.' or '['`,
+		},
+		{
+			input:     `x[0`,
+			expectErr: `Invalid key "x[0": column 2: unterminated '['`,
+		},
+		{
+			input:     `x[]`,
+			expectErr: `Invalid key "x[]": column 3: empty key segment`,
+		},
+		{
+			input:     `x['y'z]`,
+			expectErr: `Invalid key "x['y'z]": column 6: expected ']'`,
+		},
+		{
+			input:     `x.[0]`,
+			expectErr: `Invalid key "x.[0]": column 3: unexpected '['`,
+		},
 	} {
 		t.Run(tc.input, func(t *testing.T) {
-			assert.Equal(t, tc.expect, parseKeyPath(tc.input))
+			keys, err := parseKeyPath(tc.input)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, keys)
+		})
+	}
+}
+
+func TestFormatKeyPath(t *testing.T) {
+	for _, tc := range []struct {
+		keys   []string
+		expect string
+	}{
+		{
+			keys:   []string{`x`, `y`},
+			expect: `x.y`,
+		},
+		{
+			keys:   []string{`x.y`, `z`},
+			expect: `'x.y'.z`,
+		},
+		{
+			keys:   []string{`x y`, `[0]`, ``},
+			expect: `'x y'.'[0]'.''`,
+		},
+		{
+			keys:   []string{`it's`, `"quoted" \`},
+			expect: `"it's".'"quoted" \'`,
+		},
+		{
+			keys:   []string{`it's "quoted"`},
+			expect: `"it's \"quoted\""`,
+		},
+	} {
+		t.Run(tc.expect, func(t *testing.T) {
+			key := formatKeyPath(tc.keys)
+			assert.Equal(t, tc.expect, key)
+			keys, err := parseKeyPath(key)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.keys, keys)
 		})
 	}
 }
@@ -51,6 +171,12 @@ func TestDeleteKeyPath(t *testing.T) {
 			input:       map[string]interface{}{"bar": 1},
 			expect:      map[string]interface{}{"bar": 1},
 		},
+		{
+			description: "delete nested non existent key",
+			key:         "foo.bar",
+			input:       map[string]interface{}{"bar": 1},
+			expect:      map[string]interface{}{"bar": 1},
+		},
 		{
 			description: "delete map key",
 			key:         "foo",
@@ -110,7 +236,8 @@ func TestDeleteKeyPath(t *testing.T) {
 		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
-			keys := parseKeyPath(tc.key)
+			keys, err := parseKeyPath(tc.key)
+			require.NoError(t, err)
 			output, deleteMe := deleteKeyPath(tc.input, keys)
 			assert.Equal(t, tc.expectDelete, deleteMe)
 			assert.Equal(t, tc.expect, output)
@@ -211,10 +338,11 @@ func TestSortTemplateDeleteKeys(t *testing.T) {
 	} {
 		t.Run(tc.description, func(t *testing.T) {
 			content := tc.testContent
-			sortTemplateDeleteKeys(tc.keys)
+			require.NoError(t, sortTemplateDeleteKeys(tc.keys))
 			assert.Equal(t, tc.expectKeys, tc.keys)
 			for _, key := range tc.keys {
-				keyPath := parseKeyPath(key)
+				keyPath, err := parseKeyPath(key)
+				require.NoError(t, err)
 				var deleteMe bool
 				content, deleteMe = deleteKeyPath(content, keyPath)
 				assert.False(t, deleteMe)
@@ -223,3 +351,91 @@ func TestSortTemplateDeleteKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandKeyPatterns(t *testing.T) {
+	sample := func() interface{} {
+		return map[string]interface{}{
+			"servers": []interface{}{
+				map[string]interface{}{"host": "a", "debug": true},
+				map[string]interface{}{"host": "b", "debug": false},
+			},
+			"plugins": map[string]interface{}{
+				"auth":    map[string]interface{}{"debug": true},
+				"metrics": "on",
+				"web":     "on",
+			},
+			"debug": true,
+			"*":     "literal star",
+		}
+	}
+	for _, tc := range []struct {
+		description string
+		patterns    []string
+		expect      []string
+		expectErr   string
+	}{
+		{
+			description: "no patterns",
+		},
+		{
+			description: "exact keys",
+			patterns:    []string{"debug", "servers.1", "does.not.exist"},
+			expect:      []string{"debug", "servers.1"},
+		},
+		{
+			description: "single wildcard",
+			patterns:    []string{"servers.*.debug"},
+			expect:      []string{"servers.0.debug", "servers.1.debug"},
+		},
+		{
+			description: "bracketed wildcard",
+			patterns:    []string{"servers[*].host"},
+			expect:      []string{"servers.0.host", "servers.1.host"},
+		},
+		{
+			description: "quoted wildcard is literal",
+			patterns:    []string{"'*'"},
+			expect:      []string{"'*'"},
+		},
+		{
+			description: "recursive wildcard",
+			patterns:    []string{"**.debug"},
+			expect:      []string{"debug", "plugins.auth.debug", "servers.0.debug", "servers.1.debug"},
+		},
+		{
+			description: "recursive wildcard includes parent",
+			patterns:    []string{"plugins.**"},
+			expect:      []string{"plugins", "plugins.auth", "plugins.auth.debug", "plugins.metrics", "plugins.web"},
+		},
+		{
+			description: "negate wildcard match",
+			patterns:    []string{"servers.*.debug", "!servers.0.*"},
+			expect:      []string{"servers.1.debug"},
+		},
+		{
+			description: "negate nested key",
+			patterns:    []string{"!plugins.metrics", "plugins"},
+			expect:      []string{"plugins.auth", "plugins.web"},
+		},
+		{
+			description: "negate deeply nested key",
+			patterns:    []string{"plugins", "!plugins.auth.debug"},
+			expect:      []string{"plugins.metrics", "plugins.web"},
+		},
+		{
+			description: "invalid pattern",
+			patterns:    []string{"!foo..bar"},
+			expectErr:   `Invalid key "foo..bar": column 5: empty key segment`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			keys, err := expandKeyPatterns(sample(), tc.patterns)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, keys)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package env2config
+
+import (
+	"io"
+	"os"
+)
+
+// Option configures NewWithOptions
+type Option func(*options)
+
+type options struct {
+	env      map[string]string
+	registry *Registry
+	fs       FS
+	logger   Logger
+}
+
+// newOptions applies 'opts' to the default options
+func newOptions(opts []Option) options {
+	o := options{
+		registry: defaultRegistry,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.env == nil {
+		o.env = parseEnv(os.Environ())
+	}
+	return o
+}
+
+// WithEnv reads config settings and values from 'env' instead of the process's environment variables
+func WithEnv(env map[string]string) Option {
+	return func(o *options) {
+		o.env = env
+	}
+}
+
+// WithRegistry uses the formats in 'registry' instead of the default registry
+func WithRegistry(registry *Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithFS reads template files and writes config files with 'fsys' instead of the OS file system
+func WithFS(fsys FS) Option {
+	return func(o *options) {
+		o.fs = fsys
+	}
+}
+
+// WithLogger logs each file read and written to 'logger'. Nothing is logged by default.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// FS reads template files and writes config files. Names are the OS paths from <name>_OPTS_TEMPLATE_FILE and <name>_OPTS_FILE.
+type FS interface {
+	// Open opens the named file for reading
+	Open(name string) (io.ReadCloser, error)
+	// Create creates or truncates the named file for writing
+	Create(name string) (io.WriteCloser, error)
+	// MkdirAll creates a directory, along with any necessary parents
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+// Logger logs progress messages. *log.Logger implements Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (osFS) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
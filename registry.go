@@ -1,7 +1,10 @@
 package env2config
 
 import (
+	"fmt"
 	"io"
+	"sort"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -17,46 +20,240 @@ type Unmarshaler interface {
 	Unmarshal(io.Reader, interface{}) error
 }
 
-var defaultRegistry = newRegistry()
+// TemplateUnmarshaler is an Unmarshaler which also returns format-specific details about the template, like its key order.
+// The returned template is passed back to TemplateMarshaler when writing the final values.
+type TemplateUnmarshaler interface {
+	UnmarshalTemplate(r io.Reader, dest interface{}) (template interface{}, err error)
+}
+
+// TemplateMarshaler is a Marshaler which preserves details from a template while writing, like its key order.
+// The template is the one returned by TemplateUnmarshaler, or nil if there isn't a template file.
+type TemplateMarshaler interface {
+	MarshalTemplate(w io.Writer, value interface{}, template interface{}) error
+}
+
+// ArrayTemplate is a template whose top-level value is an array, like a stream of YAML documents.
+// Its elements are decoded as a map of indexes, like {"0": ..., "1": ...}, and written as an array again.
+// Other template maps are always written as maps, even if all of their keys are numbers.
+type ArrayTemplate interface {
+	IsArray() bool
+}
+
+// MarshalOptions configure a format's Marshaler and Unmarshaler
+type MarshalOptions struct {
+	// Format holds format-specific settings from <name>_OPTS_FORMAT_<setting> env vars, keyed by lowercase setting name
+	Format map[string]string
+	// Style holds output style settings shared by all formats
+	Style Style
+}
+
+// Sequence and quote styles for Style
+const (
+	SequenceBlock = "block"
+	SequenceFlow  = "flow"
+	QuoteSingle   = "single"
+	QuoteDouble   = "double"
+)
+
+// Style holds output style settings from <name>_OPTS_<setting> env vars. Formats ignore settings they don't support.
+type Style struct {
+	// Indent is the indentation for each nesting level, either spaces or a tab. Empty uses the format's default.
+	Indent string
+	// Compact writes output without optional whitespace, like JSON on one line
+	Compact bool
+	// SequenceStyle is SequenceBlock or SequenceFlow for new arrays. Empty uses the format's default.
+	SequenceStyle string
+	// QuoteStyle is QuoteSingle or QuoteDouble for new strings. Empty only quotes strings when necessary.
+	QuoteStyle string
+	// OmitTrailingNewline removes the newline at the end of the output
+	OmitTrailingNewline bool
+}
+
+// OptionsMarshaler is a Marshaler which can be configured with MarshalOptions.
+// The returned Marshaler is used for both marshaling and unmarshaling, so it should also implement Unmarshaler if 'o' does.
+type OptionsMarshaler interface {
+	WithOptions(options MarshalOptions) (Marshaler, error)
+}
+
+var defaultRegistry = NewRegistry()
 
-type registry struct {
-	marshalers   map[string]Marshaler
-	unmarshalers map[string]Unmarshaler
+// Registry holds the formats available to a Config, keyed by format name.
+// Most programs use the default registry through RegisterFormat, while tests and embedding programs can use their own from NewRegistry.
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	marshalers map[string]Marshaler
+	aliases    map[string]string
 }
 
-func newRegistry() *registry {
-	return &registry{
-		marshalers:   make(map[string]Marshaler),
-		unmarshalers: make(map[string]Unmarshaler),
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		marshalers: make(map[string]Marshaler),
+		aliases:    make(map[string]string),
 	}
 }
 
-func (r *registry) RegisterFormat(format string, marshaler Marshaler) {
+// DefaultRegistry returns the Registry used by New and the package-level RegisterFormat
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterFormat adds 'marshaler' as 'format'. If 'marshaler' is also an Unmarshaler, 'format' can be used for template files.
+// Panics if 'format' is already registered as a format or alias. Use ReplaceFormat to intentionally overwrite a format.
+func (r *Registry) RegisterFormat(format string, marshaler Marshaler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkUnused(format)
+	r.setFormat(format, marshaler)
+}
+
+// ReplaceFormat is like RegisterFormat, but overwrites any existing format with the same name
+func (r *Registry) ReplaceFormat(format string, marshaler Marshaler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, isAlias := r.aliases[format]; isAlias {
+		panic(fmt.Sprintf("Format %q is already registered as an alias", format))
+	}
+	r.setFormat(format, marshaler)
+}
+
+func (r *Registry) setFormat(format string, marshaler Marshaler) {
 	if marshaler == nil {
 		panic("Marshaler must not be nil")
 	}
 	r.marshalers[format] = marshaler
-	if unmarshaler, ok := marshaler.(Unmarshaler); ok {
-		r.unmarshalers[format] = unmarshaler
+}
+
+// RegisterAlias adds 'alias' as another name for 'format', like 'yml' for 'yaml'.
+// Panics if 'alias' is already registered as a format or alias, or if 'format' is not a registered format.
+func (r *Registry) RegisterAlias(alias, format string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkUnused(alias)
+	if _, exists := r.marshalers[format]; !exists {
+		panic(fmt.Sprintf("Format %q is not registered, so alias %q can't refer to it", format, alias))
 	}
+	r.aliases[alias] = format
 }
 
-func (r *registry) MarshalFormat(format string, w io.Writer, value interface{}) error {
-	marshaler := r.marshalers[format]
-	if marshaler == nil {
-		return errors.Errorf("Unsupported file format: %q", format)
+// checkUnused panics if 'name' is already registered. Must be called with r.mu locked.
+func (r *Registry) checkUnused(name string) {
+	if _, exists := r.marshalers[name]; exists {
+		panic(fmt.Sprintf("Format %q is already registered", name))
+	}
+	if format, isAlias := r.aliases[name]; isAlias {
+		panic(fmt.Sprintf("Format %q is already registered as an alias for %q", name, format))
+	}
+}
+
+// Formats returns the sorted names of all registered formats, not including aliases
+func (r *Registry) Formats() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	formats := make([]string, 0, len(r.marshalers))
+	for format := range r.marshalers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Aliases returns the sorted aliases of 'format'
+func (r *Registry) Aliases(format string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var aliases []string
+	for alias, aliasFormat := range r.aliases {
+		if aliasFormat == format {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Lookup returns the Marshaler for 'format' or one of its aliases, and true if it exists
+func (r *Registry) Lookup(format string) (Marshaler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if aliasFormat, isAlias := r.aliases[format]; isAlias {
+		format = aliasFormat
+	}
+	marshaler, exists := r.marshalers[format]
+	return marshaler, exists
+}
+
+// CanWrite returns true if 'format' can write files
+func (r *Registry) CanWrite(format string) bool {
+	_, exists := r.Lookup(format)
+	return exists
+}
+
+// CanRead returns true if 'format' can read template files
+func (r *Registry) CanRead(format string) bool {
+	marshaler, _ := r.Lookup(format)
+	_, isUnmarshaler := marshaler.(Unmarshaler)
+	return isUnmarshaler
+}
+
+// marshaler returns the Marshaler for 'format', configured with 'options'
+func (r *Registry) marshaler(format string, options MarshalOptions) (Marshaler, error) {
+	marshaler, exists := r.Lookup(format)
+	if !exists {
+		return nil, &UnsupportedFormatError{Format: format}
+	}
+	if optionsMarshaler, ok := marshaler.(OptionsMarshaler); ok {
+		return optionsMarshaler.WithOptions(options)
+	}
+	if len(options.Format) > 0 {
+		return nil, errors.Errorf("File format %q does not support format options", format)
+	}
+	return marshaler, nil
+}
+
+// MarshalFormat writes 'value' to 'w' in 'format'. 'template' is the template returned by UnmarshalFormat, or nil.
+func (r *Registry) MarshalFormat(format string, options MarshalOptions, w io.Writer, value interface{}, template interface{}) error {
+	marshaler, err := r.marshaler(format, options)
+	if err != nil {
+		return err
+	}
+	if templateMarshaler, ok := marshaler.(TemplateMarshaler); ok {
+		return templateMarshaler.MarshalTemplate(w, value, template)
 	}
 	return marshaler.Marshal(w, value)
 }
 
-func (r *registry) UnmarshalFormat(format string, reader io.Reader, dest interface{}) error {
-	unmarshaler := r.unmarshalers[format]
-	if unmarshaler == nil {
-		return errors.Errorf("Unsupported template file format: %q", format)
+// UnmarshalFormat reads 'reader' in 'format' into 'dest', and returns the format's template details
+func (r *Registry) UnmarshalFormat(format string, options MarshalOptions, reader io.Reader, dest interface{}) (template interface{}, err error) {
+	if !r.CanRead(format) {
+		return nil, &UnsupportedFormatError{Format: format, Template: true}
+	}
+	marshaler, err := r.marshaler(format, options)
+	if err != nil {
+		return nil, err
 	}
-	return unmarshaler.Unmarshal(reader, dest)
+	if templateUnmarshaler, ok := marshaler.(TemplateUnmarshaler); ok {
+		return templateUnmarshaler.UnmarshalTemplate(reader, dest)
+	}
+	unmarshaler, ok := marshaler.(Unmarshaler)
+	if !ok {
+		return nil, &UnsupportedFormatError{Format: format, Template: true}
+	}
+	return nil, unmarshaler.Unmarshal(reader, dest)
 }
 
+// RegisterFormat adds 'marshaler' as 'format' to the default registry. Panics if 'format' is already registered.
 func RegisterFormat(format string, marshaler Marshaler) {
 	defaultRegistry.RegisterFormat(format, marshaler)
 }
+
+// ReplaceFormat adds or overwrites 'format' in the default registry
+func ReplaceFormat(format string, marshaler Marshaler) {
+	defaultRegistry.ReplaceFormat(format, marshaler)
+}
+
+// RegisterAlias adds 'alias' as another name for 'format' in the default registry
+func RegisterAlias(alias, format string) {
+	defaultRegistry.RegisterAlias(alias, format)
+}
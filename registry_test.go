@@ -0,0 +1,134 @@
+package env2config
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type writeOnlyMarshaler struct{}
+
+func (writeOnlyMarshaler) Marshal(w io.Writer, value interface{}) error {
+	_, err := io.WriteString(w, "written")
+	return err
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterFormat("gorp", &gorpMarshaler{})
+	registry.RegisterFormat("writeonly", writeOnlyMarshaler{})
+	registry.RegisterAlias("grp", "gorp")
+	registry.RegisterAlias("gp", "gorp")
+
+	assert.Equal(t, []string{"gorp", "writeonly"}, registry.Formats())
+	assert.Equal(t, []string{"gp", "grp"}, registry.Aliases("gorp"))
+	assert.Empty(t, registry.Aliases("writeonly"))
+
+	t.Run("lookup", func(t *testing.T) {
+		marshaler, exists := registry.Lookup("gorp")
+		assert.True(t, exists)
+		assert.Equal(t, &gorpMarshaler{}, marshaler)
+
+		aliasMarshaler, exists := registry.Lookup("grp")
+		assert.True(t, exists)
+		assert.Same(t, marshaler, aliasMarshaler)
+
+		_, exists = registry.Lookup("missing")
+		assert.False(t, exists)
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		for _, tc := range []struct {
+			format    string
+			canRead   bool
+			canWrite  bool
+			expectErr string
+		}{
+			{format: "gorp", canRead: true, canWrite: true},
+			{format: "grp", canRead: true, canWrite: true},
+			{format: "writeonly", canWrite: true, expectErr: `Unsupported template file format: "writeonly"`},
+			{format: "missing", expectErr: `Unsupported template file format: "missing"`},
+		} {
+			t.Run(tc.format, func(t *testing.T) {
+				assert.Equal(t, tc.canRead, registry.CanRead(tc.format))
+				assert.Equal(t, tc.canWrite, registry.CanWrite(tc.format))
+
+				var dest map[string]interface{}
+				_, err := registry.UnmarshalFormat(tc.format, MarshalOptions{}, bytes.NewReader(nil), &dest)
+				if tc.expectErr != "" {
+					assert.EqualError(t, err, tc.expectErr)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	})
+
+	t.Run("isolated from the default registry", func(t *testing.T) {
+		_, exists := DefaultRegistry().Lookup("writeonly")
+		assert.False(t, exists)
+
+		setEnv(t, "MYPREFIX_OPTS_FILE", "/some/path")
+		setEnv(t, "MYPREFIX_OPTS_FORMAT", "writeonly")
+		config, err := NewWithRegistry("MYPREFIX", registry)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, config.registry.MarshalFormat(config.Opts.Format, config.marshalOptions(), &buf, nil, nil))
+		assert.Equal(t, "written", buf.String())
+	})
+}
+
+func TestRegistryConflicts(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterFormat("gorp", &gorpMarshaler{})
+	registry.RegisterAlias("grp", "gorp")
+
+	assert.PanicsWithValue(t, `Format "gorp" is already registered`, func() {
+		registry.RegisterFormat("gorp", writeOnlyMarshaler{})
+	})
+	assert.PanicsWithValue(t, `Format "grp" is already registered as an alias for "gorp"`, func() {
+		registry.RegisterFormat("grp", writeOnlyMarshaler{})
+	})
+	assert.PanicsWithValue(t, `Format "gorp" is already registered`, func() {
+		registry.RegisterAlias("gorp", "other")
+	})
+	assert.PanicsWithValue(t, `Format "gropr" is not registered, so alias "gr" can't refer to it`, func() {
+		registry.RegisterAlias("gr", "gropr")
+	})
+	assert.PanicsWithValue(t, `Format "grp" is not registered, so alias "gr" can't refer to it`, func() {
+		registry.RegisterAlias("gr", "grp")
+	})
+	assert.PanicsWithValue(t, `Format "grp" is already registered as an alias`, func() {
+		registry.ReplaceFormat("grp", writeOnlyMarshaler{})
+	})
+	assert.PanicsWithValue(t, "Marshaler must not be nil", func() {
+		registry.RegisterFormat("nil", nil)
+	})
+
+	registry.ReplaceFormat("gorp", writeOnlyMarshaler{})
+	marshaler, _ := registry.Lookup("grp")
+	assert.Equal(t, writeOnlyMarshaler{}, marshaler)
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	registry := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		format := "format" + strconv.Itoa(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.RegisterFormat(format, writeOnlyMarshaler{})
+			registry.RegisterAlias(format+"-alias", format)
+			registry.CanRead(format + "-alias")
+			registry.Formats()
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, registry.Formats(), 10)
+}
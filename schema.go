@@ -0,0 +1,256 @@
+package env2config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// quotedNames matches the single-quoted key names in schema error messages, like 'extra' in "additionalProperties 'extra' not allowed"
+var quotedNames = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+
+// SchemaError is returned when the generated config does not match the JSON Schema in <name>_OPTS_SCHEMA_FILE
+type SchemaError struct {
+	Path       string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for ix, violation := range e.Violations {
+		messages[ix] = "- " + violation.String()
+	}
+	return fmt.Sprintf("Config does not match schema %s:\n", e.Path) + strings.Join(messages, "\n")
+}
+
+// SchemaViolation is one value in the generated config which does not match the schema
+type SchemaViolation struct {
+	// KeyPath is the violating value's key, in the same syntax as <name>_<key>. Empty for the top-level value.
+	KeyPath string
+	// EnvVars are the sorted environment variables which set the value or keys inside it, if any
+	EnvVars []string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	keyPath := v.KeyPath
+	if keyPath == "" {
+		keyPath = "(top level)"
+	}
+	message := keyPath + ": " + v.Message
+	if len(v.EnvVars) > 0 {
+		message += " (set by " + strings.Join(v.EnvVars, ", ") + ")"
+	}
+	return message
+}
+
+// readSchema reads and compiles the JSON Schema in SchemaFile. References to other files are not allowed, since they'd be read outside of the config's FS.
+func (c Config) readSchema(fsys FS) (*jsonschema.Schema, error) {
+	f, err := fsys.Open(c.Opts.SchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, errors.Errorf("schema references must be inside the schema file, found %q", url)
+	}
+	if err := compiler.AddResource(c.Opts.SchemaFile, f); err != nil {
+		return nil, errors.Wrapf(err, "Invalid JSON schema file %s", c.Opts.SchemaFile)
+	}
+	schema, err := compiler.Compile(c.Opts.SchemaFile)
+	return schema, errors.Wrapf(err, "Invalid JSON schema file %s", c.Opts.SchemaFile)
+}
+
+// validateSchema checks 'values' against the schema file, with the types they have once written in 'output'.
+// Returns a *SchemaError naming the environment variables behind each violation.
+func (c Config) validateSchema(fsys FS, values interface{}, output []byte) error {
+	schema := c.schema
+	if schema == nil { // not compiled by NewWithOptions
+		var err error
+		schema, err = c.readSchema(fsys)
+		if err != nil {
+			return err
+		}
+	}
+	typed, err := c.writtenValues(values, output)
+	if err != nil {
+		return errors.Wrap(err, "Failed to check the generated config against its schema")
+	}
+	err = schema.Validate(typed)
+	if err == nil {
+		return nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return errors.Wrap(err, "Failed to check the generated config against its schema")
+	}
+	return &SchemaError{Path: c.Opts.SchemaFile, Violations: c.schemaViolations(validationErr)}
+}
+
+// writtenValues returns 'values' as JSON values, with the types of the values read back from 'output'.
+// Environment variables are always strings, so they're only numbers or booleans if the format writes them that way, like TOML's inferred types.
+// Formats which can't be read keep every value as a string.
+func (c Config) writtenValues(values interface{}, output []byte) (interface{}, error) {
+	if c.registry.CanRead(c.Opts.Format) {
+		var written map[string]interface{}
+		if _, err := c.registry.UnmarshalFormat(c.Opts.Format, c.marshalOptions(), bytes.NewReader(output), &written); err != nil {
+			return nil, err
+		}
+		values = withWrittenTypes(values, written)
+	}
+	// normalize values into JSON types, like int64 into a number and time.Time into a string
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var jsonValues interface{}
+	err = dec.Decode(&jsonValues)
+	return jsonValues, err
+}
+
+// withWrittenTypes replaces the scalars in 'value' with the scalars at the same key paths in 'written'.
+// The structure of 'value' is kept, since some formats flatten or rename keys when they're written.
+func withWrittenTypes(value, written interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		writtenMap, _ := written.(map[string]interface{})
+		m := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			m[key] = withWrittenTypes(elem, writtenMap[key])
+		}
+		return m
+	case []interface{}:
+		writtenSlice, _ := written.([]interface{})
+		if writtenMap, isMap := written.(map[string]interface{}); isMap {
+			writtenSlice = mapToArray(writtenMap) // streams of YAML documents are read as a map of indexes
+		}
+		a := make([]interface{}, len(value))
+		for ix, elem := range value {
+			var writtenElem interface{}
+			if ix < len(writtenSlice) {
+				writtenElem = writtenSlice[ix]
+			}
+			a[ix] = withWrittenTypes(elem, writtenElem)
+		}
+		return a
+	default:
+		switch written.(type) {
+		case nil, map[string]interface{}, []interface{}:
+			return value
+		default:
+			return written
+		}
+	}
+}
+
+// mapToArray returns the values of a map of indexes in index order, or nil if it has other keys
+func mapToArray(m map[string]interface{}) []interface{} {
+	arrays := make(arrayMaps)
+	a, _ := mapsToArrays(arrays.add(m), arrays).([]interface{})
+	return a
+}
+
+// schemaViolations returns the most specific problems in 'err', sorted by key path
+func (c Config) schemaViolations(err *jsonschema.ValidationError) []SchemaViolation {
+	envVars := c.keyEnvVars()
+	var violations []SchemaViolation
+	seen := make(map[string]bool)
+	var addLeaves func(err *jsonschema.ValidationError)
+	addLeaves = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) > 0 {
+			for _, cause := range err.Causes {
+				addLeaves(cause)
+			}
+			return
+		}
+		keyPath := formatKeyPath(parseJSONPointer(err.InstanceLocation))
+		if seen[keyPath+"\x00"+err.Message] {
+			return
+		}
+		seen[keyPath+"\x00"+err.Message] = true
+		violations = append(violations, SchemaViolation{
+			KeyPath: keyPath,
+			EnvVars: violationEnvVars(envVars, keyPath, err),
+			Message: err.Message,
+		})
+	}
+	addLeaves(err)
+	sort.SliceStable(violations, func(a, b int) bool {
+		return violations[a].KeyPath < violations[b].KeyPath
+	})
+	return violations
+}
+
+// violationEnvVars returns the environment variables which caused 'err' at 'keyPath'
+func violationEnvVars(envVars map[string]string, keyPath string, err *jsonschema.ValidationError) []string {
+	keyword := err.KeywordLocation[strings.LastIndexByte(err.KeywordLocation, '/')+1:]
+	switch keyword {
+	case "required", "dependentRequired", "dependencies":
+		return nil // missing keys aren't set by anything
+	case "additionalProperties", "unevaluatedProperties", "propertyNames":
+		// the message names the keys which aren't allowed
+		path, _ := parseKeyPath(keyPath)
+		var names []string
+		for _, match := range quotedNames.FindAllStringSubmatch(err.Message, -1) {
+			key := strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(match[1])
+			names = append(names, envVarsInside(envVars, formatKeyPath(appendKey(path, key)))...)
+		}
+		sort.Strings(names)
+		return names
+	default:
+		return envVarsInside(envVars, keyPath)
+	}
+}
+
+// parseJSONPointer splits a JSON pointer, like '/servers/0/host', into its key path
+func parseJSONPointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	keyPath := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	unescaper := strings.NewReplacer("~1", "/", "~0", "~")
+	for ix, key := range keyPath {
+		keyPath[ix] = unescaper.Replace(key)
+	}
+	return keyPath
+}
+
+// keyEnvVars returns the environment variable which set each of the config's key paths, indexed by formatted key path
+func (c Config) keyEnvVars() map[string]string {
+	envVars := make(map[string]string, len(c.Values))
+	for key, value := range c.Values {
+		keyPath, err := parseKeyPath(key)
+		if err != nil || value == deleteValue {
+			continue
+		}
+		envVar, isSet := c.envVars[key]
+		if !isSet { // not loaded from the environment by NewWithOptions
+			envVar = strings.ToUpper(c.Name) + "_" + key
+		}
+		envVars[formatKeyPath(keyPath)] = envVar
+	}
+	return envVars
+}
+
+// envVarsInside returns the sorted environment variables which set 'keyPath' or keys nested inside it
+func envVarsInside(envVars map[string]string, keyPath string) []string {
+	var names []string
+	for key, envVar := range envVars {
+		if keyPath == "" || key == keyPath || strings.HasPrefix(key, keyPath+keySeparatorStr) {
+			names = append(names, envVar)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
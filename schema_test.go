@@ -0,0 +1,161 @@
+package env2config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaFile(t *testing.T) {
+	const schema = `{
+	"type": "object",
+	"required": ["host", "port"],
+	"additionalProperties": false,
+	"properties": {
+		"host": {"type": "string", "minLength": 1},
+		"port": {"$ref": "#/definitions/port"},
+		"debug": {"type": "boolean"},
+		"level": {"enum": ["debug", "info"]},
+		"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+		"tls": {
+			"type": "object",
+			"if": {"properties": {"mode": {"const": "on"}}},
+			"then": {"required": ["cert"]}
+		}
+	},
+	"patternProperties": {
+		"^x-": {"type": "string"}
+	},
+	"definitions": {
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535}
+	}
+}`
+
+	for _, tc := range []struct {
+		description string
+		env         map[string]string
+		written     map[string]interface{} // the config's values read back from the written file
+		expectErr   string
+	}{
+		{
+			description: "valid",
+			env: map[string]string{
+				"MYPREFIX_host":     "example.com",
+				"MYPREFIX_port":     "8080",
+				"MYPREFIX_debug":    "true",
+				"MYPREFIX_level":    "info",
+				"MYPREFIX_tags.0":   "web",
+				"MYPREFIX_x-team":   "core",
+				"MYPREFIX_tls.mode": "off",
+			},
+			written: map[string]interface{}{
+				"port":  int64(8080),
+				"debug": true,
+			},
+		},
+		{
+			description: "strings are only typed if the format writes them with a type",
+			env: map[string]string{
+				"MYPREFIX_host":  "example.com",
+				"MYPREFIX_port":  "8080",
+				"MYPREFIX_debug": "1",
+			},
+			expectErr: `Config does not match schema /schema.json:
+- debug: expected boolean, but got string (set by MYPREFIX_debug)
+- port: expected integer, but got string (set by MYPREFIX_port)`,
+		},
+		{
+			description: "violations",
+			env: map[string]string{
+				"MYPREFIX_OPTS_IN_port": "BIND_PORT",
+				"BIND_PORT":             "99999",
+				"myprefix_level":        "trace",
+				"MYPREFIX_tags.0":       "web",
+				"MYPREFIX_tags.1":       "API",
+				"MYPREFIX_tags.2":       "db",
+				"MYPREFIX_extra.key":    "value",
+				"MYPREFIX_tls.mode":     "on",
+			},
+			written: map[string]interface{}{
+				"port": int64(99999),
+			},
+			expectErr: `Config does not match schema /schema.json:
+- (top level): missing properties: 'host'
+- (top level): additionalProperties 'extra' not allowed (set by MYPREFIX_extra.key)
+- level: value must be one of "debug", "info" (set by myprefix_level)
+- port: must be <= 65535 but found 99999 (set by BIND_PORT)
+- tags: maximum 2 items required, but found 3 items (set by MYPREFIX_tags.0, MYPREFIX_tags.1, MYPREFIX_tags.2)
+- tags.1: does not match pattern '^[a-z]+$' (set by MYPREFIX_tags.1)
+- tls: missing properties: 'cert'`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.RegisterFormat("gorp", &gorpMarshaler{unmarshalResult: tc.written})
+			fsys := memFS{"/schema.json": bytes.NewBufferString(schema)}
+			env := map[string]string{
+				"MYPREFIX_OPTS_FILE":        "/out.gorp",
+				"MYPREFIX_OPTS_FORMAT":      "gorp",
+				"MYPREFIX_OPTS_SCHEMA_FILE": "/schema.json",
+			}
+			for key, value := range tc.env {
+				env[key] = value
+			}
+			config, err := NewWithOptions("MYPREFIX", WithEnv(env), WithRegistry(registry), WithFS(fsys))
+			require.NoError(t, err)
+			delete(fsys, "/schema.json") // the schema is compiled once, by NewWithOptions
+			err = config.Write()
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				var schemaErr *SchemaError
+				require.True(t, errors.As(err, &schemaErr))
+				assert.Equal(t, "/schema.json", schemaErr.Path)
+				assert.NotContains(t, fsys, "/out.gorp")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, fsys, "/out.gorp")
+		})
+	}
+
+	for _, tc := range []struct {
+		description string
+		fsys        memFS
+		expectErr   string
+	}{
+		{
+			description: "missing schema file",
+			fsys:        memFS{},
+			expectErr:   "myprefix: file does not exist",
+		},
+		{
+			description: "invalid schema file",
+			fsys:        memFS{"/schema.json": bytes.NewBufferString(`{"type": 1}`)},
+			expectErr:   "myprefix: Invalid JSON schema file /schema.json: ",
+		},
+		{
+			description: "external schema reference",
+			fsys:        memFS{"/schema.json": bytes.NewBufferString(`{"$ref": "other.json"}`)},
+			expectErr:   "myprefix: Invalid JSON schema file /schema.json: ",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.RegisterFormat("gorp", &gorpMarshaler{})
+			_, err := NewWithOptions("MYPREFIX",
+				WithEnv(map[string]string{
+					"MYPREFIX_OPTS_FILE":        "/out.gorp",
+					"MYPREFIX_OPTS_FORMAT":      "gorp",
+					"MYPREFIX_OPTS_SCHEMA_FILE": "/schema.json",
+				}),
+				WithRegistry(registry),
+				WithFS(tc.fsys),
+			)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectErr)
+		})
+	}
+}